@@ -0,0 +1,183 @@
+package accesslog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	mrand "math/rand"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/snowmerak/lux/context"
+)
+
+const DefaultRequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength bounds a client supplied request id, which ends up in every log line of the request.
+const maxRequestIDLength = 128
+
+type Config struct {
+	// SkipPaths holds route patterns or raw paths that are never logged, like health checks.
+	SkipPaths []string
+	// Sampling maps a route pattern to the fraction of requests logged, between 0 and 1.
+	// Routes not in the map are always logged.
+	Sampling map[string]float64
+	// SlowThreshold logs requests slower than it at warn level. Zero disables it.
+	SlowThreshold time.Duration
+	// RequestIDHeader is read for the request id. It is generated when it is missing, longer than
+	// 128 bytes or has characters other than letters, digits, '.', '_', ':' and '-'.
+	RequestIDHeader string
+	// SubjectFunc extracts the subject of the request. Defaults to JWTSubject.
+	SubjectFunc func(*context.LuxContext) string
+}
+
+type AccessLog struct {
+	skip            map[string]struct{}
+	sampling        map[string]float64
+	slowThreshold   time.Duration
+	requestIDHeader string
+	subjectFunc     func(*context.LuxContext) string
+}
+
+func New(cfg Config) *AccessLog {
+	a := &AccessLog{
+		skip:            make(map[string]struct{}, len(cfg.SkipPaths)),
+		sampling:        make(map[string]float64, len(cfg.Sampling)),
+		slowThreshold:   cfg.SlowThreshold,
+		requestIDHeader: cfg.RequestIDHeader,
+		subjectFunc:     cfg.SubjectFunc,
+	}
+	for _, path := range cfg.SkipPaths {
+		a.skip[path] = struct{}{}
+	}
+	for route, rate := range cfg.Sampling {
+		a.sampling[route] = rate
+	}
+	if a.requestIDHeader == "" {
+		a.requestIDHeader = DefaultRequestIDHeader
+	}
+	if a.subjectFunc == nil {
+		a.subjectFunc = JWTSubject
+	}
+	return a
+}
+
+type Record struct {
+	log       *AccessLog
+	lc        *context.LuxContext
+	start     time.Time
+	requestID string
+	body      *countingBody
+}
+
+func (a *AccessLog) Begin(lc *context.LuxContext) *Record {
+	rec := &Record{
+		log:   a,
+		lc:    lc,
+		start: time.Now(),
+	}
+
+	rec.requestID = lc.Request.Header.Get(a.requestIDHeader)
+	if !validRequestID(rec.requestID) {
+		rec.requestID = newRequestID()
+		lc.Request.Header.Set(a.requestIDHeader, rec.requestID)
+	}
+	lc.Response.Headers.Set(a.requestIDHeader, rec.requestID)
+
+	if lc.Request.Body != nil {
+		rec.body = &countingBody{ReadCloser: lc.Request.Body}
+		lc.Request.Body = rec.body
+	}
+
+	return rec
+}
+
+func (r *Record) End() {
+	lc := r.lc
+	route := lc.RoutePattern
+	if _, ok := r.log.skip[route]; ok {
+		return
+	}
+	if _, ok := r.log.skip[lc.Request.URL.Path]; ok {
+		return
+	}
+	if rate, ok := r.log.sampling[route]; ok && mrand.Float64() >= rate {
+		return
+	}
+
+	latency := time.Since(r.start)
+	status := lc.Response.StatusCode
+
+	var event *zerolog.Event
+	switch {
+	case status >= 500:
+		event = lc.Logger.Error()
+	case r.log.slowThreshold > 0 && latency >= r.log.slowThreshold:
+		event = lc.Logger.Warn().Bool("slow", true)
+	default:
+		event = lc.Logger.Info()
+	}
+
+	bytesIn := lc.Request.ContentLength
+	if bytesIn < 0 && r.body != nil {
+		bytesIn = r.body.n
+	}
+
+	event.Str("method", lc.Request.Method).
+		Str("route", route).
+		Str("path", lc.Request.URL.EscapedPath()).
+		Int("status", status).
+		Int64("bytes_in", bytesIn).
+		Int("bytes_out", len(lc.Response.Body)).
+		Dur("latency", latency).
+		Str("remote_ip", lc.GetRemoteIP()).
+		Str("user_agent", lc.Request.UserAgent()).
+		Str("request_id", r.requestID).
+		Str("subject", r.log.subjectFunc(lc)).
+		Msg("access")
+}
+
+// JWTSubject returns the subject of the claims verified by middleware.JWTAuth, or the Principal.
+// The token is not parsed again, so routes without an auth middleware log no subject.
+func JWTSubject(lc *context.LuxContext) string {
+	if lc.Claims != nil {
+		sub, _ := lc.Claims.GetSubject()
+		return sub
+	}
+	return lc.Principal
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '.', c == '_', c == ':', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,39 @@
+package accesslog
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/snowmerak/lux/context"
+)
+
+func TestBeginRequestID(t *testing.T) {
+	a := New(Config{})
+	for in, keep := range map[string]bool{
+		"":                          false,
+		"abc-123":                   true,
+		"trace.id_01:span-02":       true,
+		strings.Repeat("a", 128):    true,
+		strings.Repeat("a", 129):    false,
+		"id with spaces":            false,
+		"id\r\nX-Injected: 1":       false,
+		"<script>alert(1)</script>": false,
+		"été":                       false,
+	} {
+		lc := &context.LuxContext{Request: httptest.NewRequest("GET", "/", nil), Response: context.NewResponse()}
+		if in != "" {
+			lc.Request.Header.Set(DefaultRequestIDHeader, in)
+		}
+		rec := a.Begin(lc)
+		if got := rec.requestID == in; got != keep {
+			t.Errorf("request id %q kept = %v, want %v", in, got, keep)
+		}
+		if !validRequestID(rec.requestID) {
+			t.Errorf("request id %q replaced by invalid %q", in, rec.requestID)
+		}
+		if lc.Response.Headers.Get(DefaultRequestIDHeader) != rec.requestID || lc.Request.Header.Get(DefaultRequestIDHeader) != rec.requestID {
+			t.Errorf("request id %q is not propagated to the headers", rec.requestID)
+		}
+	}
+}
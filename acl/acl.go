@@ -0,0 +1,295 @@
+package acl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+	"github.com/snowmerak/lux/signal"
+)
+
+type Action int
+
+const (
+	Deny Action = iota
+	Allow
+)
+
+func (a Action) String() string {
+	if a == Allow {
+		return "allow"
+	}
+	return "deny"
+}
+
+func parseAction(s string) (Action, error) {
+	switch strings.ToLower(s) {
+	case "allow":
+		return Allow, nil
+	case "deny":
+		return Deny, nil
+	}
+	return Deny, fmt.Errorf("acl: unknown action %q", s)
+}
+
+type Precedence int
+
+const (
+	// DenyFirst denies an address matched by any deny rule, even when an allow rule also matches.
+	DenyFirst Precedence = iota
+	// AllowFirst allows an address matched by any allow rule, even when a deny rule also matches.
+	AllowFirst
+	// LongestMatch applies the most specific matching rule, whatever its action.
+	LongestMatch
+)
+
+func parsePrecedence(s string) (Precedence, error) {
+	switch strings.ToLower(s) {
+	case "deny":
+		return DenyFirst, nil
+	case "allow":
+		return AllowFirst, nil
+	case "longest":
+		return LongestMatch, nil
+	}
+	return DenyFirst, fmt.Errorf("acl: unknown precedence %q", s)
+}
+
+var ErrNilList = errors.New("acl: nil list")
+
+type Rule struct {
+	Action Action
+	Prefix netip.Prefix
+	Source string
+}
+
+func (r *Rule) String() string {
+	if r == nil {
+		return "default"
+	}
+	s := r.Action.String() + " " + r.Prefix.String()
+	if r.Source != "" {
+		s += " (" + r.Source + ")"
+	}
+	return s
+}
+
+type List struct {
+	Default    Action
+	Precedence Precedence
+
+	allow trie
+	deny  trie
+	all   trie
+}
+
+func NewList(defaultAction Action, precedence Precedence) *List {
+	return &List{
+		Default:    defaultAction,
+		Precedence: precedence,
+	}
+}
+
+// Add adds a rule for a CIDR or a single IPv4 or IPv6 address.
+func (l *List) Add(action Action, cidr string, source string) error {
+	prefix, err := parsePrefix(cidr)
+	if err != nil {
+		return err
+	}
+	rule := &Rule{Action: action, Prefix: prefix, Source: source}
+	if action == Allow {
+		l.allow.insert(prefix, rule)
+	} else {
+		l.deny.insert(prefix, rule)
+	}
+	l.all.insert(prefix, rule)
+	return nil
+}
+
+func (l *List) Len() int {
+	return l.all.size
+}
+
+type Decision struct {
+	Allowed bool
+	Rule    *Rule
+}
+
+func (l *List) Decide(addr netip.Addr) Decision {
+	switch l.Precedence {
+	case AllowFirst:
+		if rule := l.allow.lookup(addr); rule != nil {
+			return Decision{Allowed: true, Rule: rule}
+		}
+		if rule := l.deny.lookup(addr); rule != nil {
+			return Decision{Allowed: false, Rule: rule}
+		}
+	case LongestMatch:
+		if rule := l.all.lookup(addr); rule != nil {
+			return Decision{Allowed: rule.Action == Allow, Rule: rule}
+		}
+	default:
+		if rule := l.deny.lookup(addr); rule != nil {
+			return Decision{Allowed: false, Rule: rule}
+		}
+		if rule := l.allow.lookup(addr); rule != nil {
+			return Decision{Allowed: true, Rule: rule}
+		}
+	}
+	return Decision{Allowed: l.Default == Allow}
+}
+
+func parsePrefix(cidr string) (netip.Prefix, error) {
+	cidr = strings.TrimSpace(cidr)
+	if strings.Contains(cidr, "/") {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(strings.Trim(cidr, "[]"))
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap().WithZone("")
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Parse reads a list with one directive per line:
+//
+//	default deny
+//	precedence longest
+//	allow 10.0.0.0/8
+//	deny 10.1.2.3 # comments run to the end of the line
+func Parse(r io.Reader, name string) (*List, error) {
+	list := NewList(Deny, DenyFirst)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("acl: %s:%d: expected two fields", name, line)
+		}
+		var err error
+		switch strings.ToLower(fields[0]) {
+		case "default":
+			list.Default, err = parseAction(fields[1])
+		case "precedence":
+			list.Precedence, err = parsePrecedence(fields[1])
+		default:
+			var action Action
+			action, err = parseAction(fields[0])
+			if err == nil {
+				err = list.Add(action, fields[1], fmt.Sprintf("%s:%d", name, line))
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("acl: %s:%d: %w", name, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func LoadFile(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f, path)
+}
+
+// Engine holds the active list. Lists are swapped atomically, so requests
+// in flight keep deciding against the list they started with.
+type Engine struct {
+	list   atomic.Pointer[List]
+	logger *zerolog.Logger
+}
+
+func NewEngine(list *List, logger *zerolog.Logger) *Engine {
+	e := &Engine{logger: logger}
+	if list == nil {
+		list = NewList(Allow, DenyFirst)
+	}
+	e.list.Store(list)
+	return e
+}
+
+func (e *Engine) List() *List {
+	return e.list.Load()
+}
+
+// Swap activates list and returns the previous one. A nil list is rejected with ErrNilList.
+func (e *Engine) Swap(list *List) (*List, error) {
+	if list == nil {
+		return nil, ErrNilList
+	}
+	return e.list.Swap(list), nil
+}
+
+func (e *Engine) Decide(ip string) Decision {
+	addr, err := netip.ParseAddr(strings.Trim(ip, "[]"))
+	list := e.list.Load()
+	if err != nil {
+		return Decision{Allowed: list.Default == Allow}
+	}
+	return list.Decide(addr)
+}
+
+func (e *Engine) ReloadFile(path string) error {
+	list, err := LoadFile(path)
+	if err != nil {
+		return err
+	}
+	if _, err := e.Swap(list); err != nil {
+		return err
+	}
+	if e.logger != nil {
+		e.logger.Info().Str("path", path).Int("rules", list.Len()).Msg("ACL reloaded")
+	}
+	return nil
+}
+
+// WatchFile loads path and reloads it on every SIGHUP until ctx is done.
+// A list that fails to parse is logged and the previous list stays active.
+func (e *Engine) WatchFile(ctx context.Context, path string) error {
+	if err := e.ReloadFile(path); err != nil {
+		return err
+	}
+	hup := signal.Hangup(ctx)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				if err := e.ReloadFile(path); err != nil && e.logger != nil {
+					e.logger.Error().Str("path", path).Err(err).Msg("ACL reload failed")
+				}
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,62 @@
+package acl
+
+import "net/netip"
+
+// trie is a binary radix tree over 128-bit addresses. IPv4 prefixes are stored
+// in their IPv4-mapped IPv6 form, so one tree serves both families.
+type trie struct {
+	root node
+	size int
+}
+
+type node struct {
+	children [2]*node
+	rule     *Rule
+}
+
+func (t *trie) insert(prefix netip.Prefix, rule *Rule) {
+	addr, bits := normalize(prefix.Addr(), prefix.Bits())
+	key := addr.As16()
+	n := &t.root
+	for i := 0; i < bits; i++ {
+		b := bit(key, i)
+		if n.children[b] == nil {
+			n.children[b] = &node{}
+		}
+		n = n.children[b]
+	}
+	if n.rule == nil {
+		t.size++
+	}
+	n.rule = rule
+}
+
+// lookup returns the rule of the longest prefix containing addr.
+func (t *trie) lookup(addr netip.Addr) *Rule {
+	addr, _ = normalize(addr, 0)
+	key := addr.As16()
+	n := &t.root
+	match := n.rule
+	for i := 0; i < 128; i++ {
+		n = n.children[bit(key, i)]
+		if n == nil {
+			break
+		}
+		if n.rule != nil {
+			match = n.rule
+		}
+	}
+	return match
+}
+
+func normalize(addr netip.Addr, bits int) (netip.Addr, int) {
+	addr = addr.Unmap()
+	if addr.Is4() {
+		return netip.AddrFrom16(addr.As16()), bits + 96
+	}
+	return addr.WithZone(""), bits
+}
+
+func bit(key [16]byte, i int) int {
+	return int(key[i/8]>>(7-uint(i%8))) & 1
+}
@@ -0,0 +1,214 @@
+package lux
+
+import (
+	ctx "context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+)
+
+const acmeTLSProtocol = "acme-tls/1"
+
+type AutoTLSConfig struct {
+	// Addr is the TLS listen address. Empty means ":https".
+	Addr string
+	// HTTPAddr serves ACME HTTP-01 challenges and redirects other requests to HTTPS.
+	// Empty means ":http", "-" disables the listener.
+	HTTPAddr string
+	// Email is the ACME account contact.
+	Email string
+	// CA is the ACME directory URL. Empty means Let's Encrypt production.
+	CA string
+	// TrustedRoots verifies the CA, e.g. a local ACME server in tests. Nil uses the system roots.
+	TrustedRoots *x509.CertPool
+	// StorageDir holds accounts and certificates. Empty means certmagic's default directory.
+	StorageDir string
+	// DNSProvider solves DNS-01 challenges, see github.com/libdns. HTTP-01 and TLS-ALPN-01 are disabled when it is set.
+	DNSProvider certmagic.ACMEDNSProvider
+	// OnDemand obtains certificates during the handshake for every name it does not reject.
+	OnDemand func(name string) error
+	// AltHTTPPort and AltTLSALPNPort are the ports the CA validates challenges on when they are not 80 and 443.
+	AltHTTPPort    int
+	AltTLSALPNPort int
+}
+
+// SetAutoTLS configures the ACME certificates used by the AutoTLS listen methods.
+func (l *Lux) SetAutoTLS(cfg *AutoTLSConfig) {
+	l.autoTLS = cfg
+}
+
+func (l *Lux) ListenAndServe1AutoTLS(ctx ctx.Context, domains []string) error {
+	if err := l.serveAutoTLS(ctx, domains, false); err != nil {
+		l.logger.Fatal().Str("error", err.Error()).Msg("Listen and serve Auto TLS error")
+		return err
+	}
+	return nil
+}
+
+func (l *Lux) ListenAndServe2AutoTLS(ctx ctx.Context, domains []string) error {
+	if err := l.configureHTTP2(); err != nil {
+		l.logger.Fatal().Str("error", err.Error()).Msg("Http2 configuration error")
+		return err
+	}
+	if err := l.serveAutoTLS(ctx, domains, false); err != nil {
+		l.logger.Fatal().Str("error", err.Error()).Msg("Listen and serve http2 Auto TLS error")
+		return err
+	}
+	return nil
+}
+
+func (l *Lux) serveAutoTLS(ctx ctx.Context, domains []string, h3 bool) error {
+	cfg := AutoTLSConfig{}
+	if l.autoTLS != nil {
+		cfg = *l.autoTLS
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = ":https"
+	}
+	if cfg.HTTPAddr == "" {
+		cfg.HTTPAddr = ":http"
+	}
+	if len(domains) == 0 && cfg.OnDemand == nil {
+		return errors.New("auto tls requires domains or an on-demand policy")
+	}
+
+	magic, issuer, cache := newCertMagic(cfg)
+	defer cache.Stop()
+
+	l.buildServer(ctx, cfg.Addr)
+	tlsConfig := l.TLSConfig()
+	tlsConfig.GetCertificate = magic.GetCertificate
+	for _, proto := range []string{"h2", "http/1.1", acmeTLSProtocol} {
+		if !containsString(tlsConfig.NextProtos, proto) {
+			tlsConfig.NextProtos = append(tlsConfig.NextProtos, proto)
+		}
+	}
+	// cleanup releases the sockets opened before the TLS listener when it fails to start.
+	var cleanup []func()
+	fail := func(err error) error {
+		for _, c := range cleanup {
+			c()
+		}
+		return err
+	}
+	if h3 {
+		closeHTTP3, err := l.startHTTP3(cfg.Addr, tlsConfig.Clone())
+		if err != nil {
+			return err
+		}
+		cleanup = append(cleanup, closeHTTP3)
+	}
+
+	if cfg.HTTPAddr != "-" {
+		_, port, _ := net.SplitHostPort(cfg.Addr)
+		challenge := &http.Server{
+			Addr:              cfg.HTTPAddr,
+			Handler:           issuer.HTTPChallengeHandler(httpsRedirect(port)),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		ln, err := net.Listen("tcp", cfg.HTTPAddr)
+		if err != nil {
+			return fail(err)
+		}
+		cleanup = append(cleanup, func() {
+			challenge.Close()
+			ln.Close()
+		})
+		l.addShutdownHook(challenge.Shutdown)
+		go func() {
+			if err := challenge.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				l.logger.Error().Str("error", err.Error()).Msg("ACME challenge server error")
+			}
+		}()
+	}
+
+	if len(domains) > 0 {
+		if err := magic.ManageAsync(ctx, domains); err != nil {
+			return fail(err)
+		}
+	}
+
+	err := l.serve(ctx, cfg.Addr, func(ln net.Listener) error {
+		return l.server.ServeTLS(ln, "", "")
+	})
+	if err != nil {
+		return fail(err)
+	}
+	return nil
+}
+
+func newCertMagic(cfg AutoTLSConfig) (*certmagic.Config, *certmagic.ACMEIssuer, *certmagic.Cache) {
+	var magic *certmagic.Config
+	cache := certmagic.NewCache(certmagic.CacheOptions{
+		GetConfigForCert: func(certmagic.Certificate) (*certmagic.Config, error) {
+			return magic, nil
+		},
+	})
+	template := certmagic.Config{}
+	if cfg.StorageDir != "" {
+		template.Storage = &certmagic.FileStorage{Path: cfg.StorageDir}
+	}
+	if cfg.OnDemand != nil {
+		template.OnDemand = &certmagic.OnDemandConfig{DecisionFunc: cfg.OnDemand}
+	}
+	magic = certmagic.New(cache, template)
+
+	issuer := certmagic.ACMEIssuer{
+		CA:             cfg.CA,
+		Email:          cfg.Email,
+		Agreed:         true,
+		TrustedRoots:   cfg.TrustedRoots,
+		AltHTTPPort:    cfg.AltHTTPPort,
+		AltTLSALPNPort: cfg.AltTLSALPNPort,
+	}
+	if cfg.CA == "" {
+		issuer.CA = certmagic.LetsEncryptProductionCA
+	}
+	if cfg.DNSProvider != nil {
+		issuer.DNS01Solver = &certmagic.DNS01Solver{DNSProvider: cfg.DNSProvider}
+		issuer.DisableHTTPChallenge = true
+		issuer.DisableTLSALPNChallenge = true
+	}
+	acme := certmagic.NewACMEIssuer(magic, issuer)
+	magic.Issuers = []certmagic.Issuer{acme}
+	return magic, acme, cache
+}
+
+// httpsRedirect redirects GET and HEAD requests to the same host on port. Other methods get 400,
+// since a redirect would drop their body.
+func httpsRedirect(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "use https", http.StatusBadRequest)
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if port != "" && port != "443" && port != "https" {
+			host += ":" + port
+		}
+		w.Header().Set("Connection", "close")
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package lux
+
+import (
+	ctx "context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/caddyserver/certmagic"
+	"github.com/rs/zerolog"
+)
+
+// fakeDNS only has to satisfy certmagic.ACMEDNSProvider, it is never called.
+type fakeDNS struct {
+	certmagic.ACMEDNSProvider
+}
+
+func TestNewCertMagicDefaults(t *testing.T) {
+	magic, issuer, cache := newCertMagic(AutoTLSConfig{})
+	defer cache.Stop()
+
+	if issuer.CA != certmagic.LetsEncryptProductionCA {
+		t.Errorf("CA = %q", issuer.CA)
+	}
+	if !issuer.Agreed {
+		t.Error("terms are not agreed")
+	}
+	if issuer.DisableHTTPChallenge || issuer.DisableTLSALPNChallenge || issuer.DNS01Solver != nil {
+		t.Errorf("challenges = http %v, tls-alpn %v, dns %v", !issuer.DisableHTTPChallenge, !issuer.DisableTLSALPNChallenge, issuer.DNS01Solver)
+	}
+	if magic.OnDemand != nil {
+		t.Error("OnDemand is set without a policy")
+	}
+	if len(magic.Issuers) != 1 || magic.Issuers[0] != certmagic.Issuer(issuer) {
+		t.Errorf("Issuers = %v", magic.Issuers)
+	}
+}
+
+func TestNewCertMagicFromConfig(t *testing.T) {
+	roots := x509.NewCertPool()
+	storage := t.TempDir()
+	var asked string
+	cfg := AutoTLSConfig{
+		Email:          "ops@example.com",
+		CA:             "https://acme.example/dir",
+		TrustedRoots:   roots,
+		StorageDir:     storage,
+		AltHTTPPort:    5002,
+		AltTLSALPNPort: 5001,
+		OnDemand: func(name string) error {
+			asked = name
+			if name != "allowed.example" {
+				return errors.New("not allowed")
+			}
+			return nil
+		},
+	}
+	magic, issuer, cache := newCertMagic(cfg)
+	defer cache.Stop()
+
+	if issuer.CA != cfg.CA || issuer.Email != cfg.Email || issuer.TrustedRoots != roots {
+		t.Errorf("issuer = CA %q, email %q, roots %p", issuer.CA, issuer.Email, issuer.TrustedRoots)
+	}
+	if issuer.AltHTTPPort != 5002 || issuer.AltTLSALPNPort != 5001 {
+		t.Errorf("alt ports = %d, %d", issuer.AltHTTPPort, issuer.AltTLSALPNPort)
+	}
+	if fs, ok := magic.Storage.(*certmagic.FileStorage); !ok || fs.Path != storage {
+		t.Errorf("Storage = %#v", magic.Storage)
+	}
+	if magic.OnDemand == nil || magic.OnDemand.DecisionFunc == nil {
+		t.Fatal("OnDemand is not set")
+	}
+	if err := magic.OnDemand.DecisionFunc("allowed.example"); err != nil || asked != "allowed.example" {
+		t.Errorf("DecisionFunc(allowed.example) = %v, asked %q", err, asked)
+	}
+	if err := magic.OnDemand.DecisionFunc("other.example"); err == nil {
+		t.Error("DecisionFunc(other.example) allowed the name")
+	}
+}
+
+func TestNewCertMagicDNSProvider(t *testing.T) {
+	dns := fakeDNS{}
+	_, issuer, cache := newCertMagic(AutoTLSConfig{DNSProvider: dns})
+	defer cache.Stop()
+
+	solver, ok := issuer.DNS01Solver.(*certmagic.DNS01Solver)
+	if !ok || solver.DNSProvider != certmagic.ACMEDNSProvider(dns) {
+		t.Fatalf("DNS01Solver = %#v", issuer.DNS01Solver)
+	}
+	if !issuer.DisableHTTPChallenge || !issuer.DisableTLSALPNChallenge {
+		t.Error("HTTP-01 and TLS-ALPN-01 stay enabled with a DNS provider")
+	}
+}
+
+func TestServeAutoTLSRequiresDomains(t *testing.T) {
+	logger := zerolog.Nop()
+	l := New(nil, &logger)
+	if err := l.serveAutoTLS(ctx.Background(), nil, false); err == nil {
+		t.Fatal("serveAutoTLS without domains or on-demand policy succeeded")
+	}
+}
+
+func TestServeAutoTLSReleasesSocketsOnFailure(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	free, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := free.LocalAddr().String()
+	free.Close()
+
+	logger := zerolog.Nop()
+	l := New(nil, &logger)
+	l.SetAutoTLS(&AutoTLSConfig{Addr: addr, HTTPAddr: busy.Addr().String()})
+	if err := l.serveAutoTLS(ctx.Background(), []string{"localhost"}, true); err == nil {
+		t.Fatal("serveAutoTLS succeeded on a busy challenge port")
+	}
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		t.Fatalf("HTTP/3 socket is still bound: %v", err)
+	}
+	conn.Close()
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	for _, tc := range []struct {
+		port, method, target, location string
+		status                         int
+	}{
+		{"443", http.MethodGet, "http://example.com/a?b=c", "https://example.com/a?b=c", http.StatusMovedPermanently},
+		{"https", http.MethodHead, "http://example.com:8080/", "https://example.com/", http.StatusMovedPermanently},
+		{"8443", http.MethodGet, "http://example.com/x", "https://example.com:8443/x", http.StatusMovedPermanently},
+		{"", http.MethodGet, "http://[::1]:80/", "https://[::1]/", http.StatusMovedPermanently},
+		{"8443", http.MethodGet, "http://[::1]/", "https://[::1]:8443/", http.StatusMovedPermanently},
+		{"443", http.MethodPost, "http://example.com/form", "", http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		httpsRedirect(tc.port).ServeHTTP(w, httptest.NewRequest(tc.method, tc.target, nil))
+		if w.Code != tc.status || w.Header().Get("Location") != tc.location {
+			t.Errorf("%s %s on port %q = %d %q, want %d %q", tc.method, tc.target, tc.port, w.Code, w.Header().Get("Location"), tc.status, tc.location)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/snowmerak/lux/metrics"
+	"github.com/snowmerak/lux/signal"
+)
+
+const DefaultExpiryWarning = 14 * 24 * time.Hour
+
+var ErrNoCertificates = errors.New("certs: no certificates")
+
+type Pair struct {
+	CertFile string
+	KeyFile  string
+}
+
+type loaded struct {
+	pair     Pair
+	cert     *tls.Certificate
+	leaf     *x509.Certificate
+	modTimes [2]time.Time
+}
+
+// store is immutable once built, so GetCertificate can read it without locks.
+type store struct {
+	pairs    []*loaded
+	exact    map[string]*tls.Certificate
+	wildcard map[string]*tls.Certificate
+}
+
+// Manager serves several certificates by SNI and reloads them from disk without a restart.
+// The first pair is the default for clients that send no or an unknown server name.
+type Manager struct {
+	pairs  []Pair
+	store  atomic.Pointer[store]
+	logger *zerolog.Logger
+
+	// lock serializes reloads and guards the expiry metric and its series.
+	lock   sync.Mutex
+	expiry *metrics.GaugeVec
+	series map[[2]string]struct{}
+	// ExpiryWarning is how long before expiry reloads start logging warnings. Zero means DefaultExpiryWarning.
+	ExpiryWarning time.Duration
+}
+
+func NewManager(logger *zerolog.Logger, pairs ...Pair) (*Manager, error) {
+	if len(pairs) == 0 {
+		return nil, ErrNoCertificates
+	}
+	m := &Manager{pairs: pairs, logger: logger}
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// RegisterMetrics exports lux_tls_certificate_expiry_timestamp_seconds per certificate file.
+// Only the first call registers the metric; later calls do nothing.
+func (m *Manager) RegisterMetrics(r *metrics.Registry) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.expiry != nil {
+		return
+	}
+	m.expiry = r.NewGaugeVec("lux_tls_certificate_expiry_timestamp_seconds", "Expiry time of the served TLS certificates in unix seconds.", "cert_file", "common_name")
+	m.setExpiry(m.store.Load())
+}
+
+// setExpiry publishes the expiry of s and deletes the series of certificates it replaced. The caller holds m.lock.
+func (m *Manager) setExpiry(s *store) {
+	if m.expiry == nil {
+		return
+	}
+	current := make(map[[2]string]struct{}, len(s.pairs))
+	for _, l := range s.pairs {
+		labels := [2]string{l.pair.CertFile, l.leaf.Subject.CommonName}
+		current[labels] = struct{}{}
+		m.expiry.With(labels[0], labels[1]).Set(float64(l.leaf.NotAfter.Unix()))
+	}
+	for labels := range m.series {
+		if _, ok := current[labels]; !ok {
+			m.expiry.Delete(labels[0], labels[1])
+		}
+	}
+	m.series = current
+}
+
+// Reload loads every pair and swaps them in at once. When any pair fails, the previous certificates stay.
+func (m *Manager) Reload() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	next := &store{
+		exact:    map[string]*tls.Certificate{},
+		wildcard: map[string]*tls.Certificate{},
+	}
+	for _, pair := range m.pairs {
+		cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			return fmt.Errorf("certs: %s: %w", pair.CertFile, err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("certs: %s: %w", pair.CertFile, err)
+		}
+		cert.Leaf = leaf
+		next.pairs = append(next.pairs, &loaded{pair: pair, cert: &cert, leaf: leaf, modTimes: modTimes(pair)})
+
+		names := leaf.DNSNames
+		if len(names) == 0 && leaf.Subject.CommonName != "" {
+			names = []string{leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if suffix, ok := strings.CutPrefix(name, "*."); ok {
+				if _, exists := next.wildcard[suffix]; !exists {
+					next.wildcard[suffix] = &cert
+				}
+				continue
+			}
+			if _, exists := next.exact[name]; !exists {
+				next.exact[name] = &cert
+			}
+		}
+	}
+	m.store.Store(next)
+	m.setExpiry(next)
+	m.report(next)
+	return nil
+}
+
+func (m *Manager) report(s *store) {
+	warning := m.ExpiryWarning
+	if warning <= 0 {
+		warning = DefaultExpiryWarning
+	}
+	if m.logger == nil {
+		return
+	}
+	for _, l := range s.pairs {
+		left := time.Until(l.leaf.NotAfter)
+		event := m.logger.Info()
+		switch {
+		case left <= 0:
+			event = m.logger.Error()
+		case left <= warning:
+			event = m.logger.Warn()
+		}
+		event.Str("cert_file", l.pair.CertFile).Strs("names", l.leaf.DNSNames).Time("not_after", l.leaf.NotAfter).Dur("expires_in", left).Msg("TLS certificate loaded")
+	}
+}
+
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s := m.store.Load()
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := s.exact[name]; ok {
+		return cert, nil
+	}
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		if cert, ok := s.wildcard[name[i+1:]]; ok {
+			return cert, nil
+		}
+	}
+	return s.pairs[0].cert, nil
+}
+
+// Config returns a tls.Config serving the managed certificates, with TLS 1.2 as minimum and h2 and http/1.1 as ALPN.
+// Adjust it before handing it to Lux.SetTLSConfig.
+func (m *Manager) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: m.GetCertificate,
+	}
+}
+
+// Watch reloads on every SIGHUP until ctx is done, and also when a file changes if interval is positive.
+// Failed reloads are logged and the previous certificates stay.
+func (m *Manager) Watch(ctx context.Context, interval time.Duration) {
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		tick = ticker.C
+		go func() {
+			<-ctx.Done()
+			ticker.Stop()
+		}()
+	}
+	hup := signal.Hangup(ctx)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+			case <-tick:
+				if !m.changed() {
+					continue
+				}
+			}
+			if err := m.Reload(); err != nil && m.logger != nil {
+				m.logger.Error().Err(err).Msg("TLS certificate reload failed")
+			}
+		}
+	}()
+}
+
+func (m *Manager) changed() bool {
+	for _, l := range m.store.Load().pairs {
+		if modTimes(l.pair) != l.modTimes {
+			return true
+		}
+	}
+	return false
+}
+
+func modTimes(pair Pair) [2]time.Time {
+	times := [2]time.Time{}
+	for i, file := range []string{pair.CertFile, pair.KeyFile} {
+		if info, err := os.Stat(file); err == nil {
+			times[i] = info.ModTime()
+		}
+	}
+	return times
+}
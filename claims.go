@@ -0,0 +1,27 @@
+package lux
+
+import (
+	"encoding/json"
+
+	"github.com/snowmerak/lux/context"
+)
+
+// Claims returns the claims stored by middleware.JWTAuth as T. T is usually a struct with json tags,
+// or a type implementing jwt.Claims, which is returned as is when it is the stored type.
+func Claims[T any](l *context.LuxContext) (T, bool) {
+	var claims T
+	if l.Claims == nil {
+		return claims, false
+	}
+	if c, ok := l.Claims.(T); ok {
+		return c, true
+	}
+	raw, err := json.Marshal(l.Claims)
+	if err != nil {
+		return claims, false
+	}
+	if err := json.Unmarshal(raw, &claims); err != nil {
+		return claims, false
+	}
+	return claims, true
+}
@@ -0,0 +1,47 @@
+package context
+
+import (
+	"crypto/x509"
+	"net"
+	"net/url"
+)
+
+// CertIdentity describes a verified client certificate.
+type CertIdentity struct {
+	Subject            string
+	CommonName         string
+	Organizations      []string
+	OrganizationalUnit []string
+	DNSNames           []string
+	EmailAddresses     []string
+	IPAddresses        []net.IP
+	URIs               []*url.URL
+	// SPIFFEID is the first spiffe:// URI SAN, or empty.
+	SPIFFEID     string
+	Issuer       string
+	SerialNumber string
+	Certificate  *x509.Certificate
+}
+
+func NewCertIdentity(cert *x509.Certificate) *CertIdentity {
+	id := &CertIdentity{
+		Subject:            cert.Subject.String(),
+		CommonName:         cert.Subject.CommonName,
+		Organizations:      cert.Subject.Organization,
+		OrganizationalUnit: cert.Subject.OrganizationalUnit,
+		DNSNames:           cert.DNSNames,
+		EmailAddresses:     cert.EmailAddresses,
+		IPAddresses:        cert.IPAddresses,
+		URIs:               cert.URIs,
+		Issuer:             cert.Issuer.String(),
+		SerialNumber:       cert.SerialNumber.String(),
+		Certificate:        cert,
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			id.SPIFFEID = uri.String()
+			break
+		}
+	}
+	return id
+}
@@ -0,0 +1,40 @@
+package context
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// MapClaims returns claims as a map, converting typed claims through their JSON form.
+func MapClaims(claims jwt.Claims) jwt.MapClaims {
+	if m, ok := claims.(jwt.MapClaims); ok {
+		return m
+	}
+	m := jwt.MapClaims{}
+	if raw, err := json.Marshal(claims); err == nil {
+		json.Unmarshal(raw, &m)
+	}
+	return m
+}
+
+// ClaimStrings reads claims that are either a space separated string or an array of strings.
+func ClaimStrings(values ...any) []string {
+	result := []string(nil)
+	for _, value := range values {
+		switch v := value.(type) {
+		case string:
+			result = append(result, strings.Fields(v)...)
+		case []string:
+			result = append(result, v...)
+		case []any:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					result = append(result, s)
+				}
+			}
+		}
+	}
+	return result
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/rs/zerolog"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -44,6 +45,25 @@ type LuxContext struct {
 	RequestContext context.Context
 	Logger         *zerolog.Logger
 	JWTConfig      *JWTConfig
+	RoutePattern   string
+	ClientIP       string
+	// Claims holds the verified access token claims stored by middleware.JWTAuth.
+	Claims jwt.Claims
+	// Principal is the identity authenticated by middleware.APIKey or middleware.BasicAuth.
+	Principal string
+	// ClientCert is the verified TLS client certificate, or nil.
+	ClientCert *CertIdentity
+}
+
+type luxContextKey struct{}
+
+func WithLuxContext(parent context.Context, l *LuxContext) context.Context {
+	return context.WithValue(parent, luxContextKey{}, l)
+}
+
+func FromContext(ctx context.Context) (*LuxContext, bool) {
+	l, ok := ctx.Value(luxContextKey{}).(*LuxContext)
+	return l, ok
 }
 
 func (l *LuxContext) IsOk() bool {
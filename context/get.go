@@ -6,6 +6,8 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
+
+	"github.com/snowmerak/lux/util"
 )
 
 func (l *LuxContext) GetFormFile(name string) (multipart.File, *multipart.FileHeader, error) {
@@ -84,20 +86,14 @@ func (l *LuxContext) GetRemoteAddress() string {
 	return l.Request.RemoteAddr
 }
 
+// GetRemoteIP returns the client IP. Behind trusted proxies (Lux.SetTrustedProxies) it is the address
+// resolved from the forwarding headers, otherwise the host of Request.RemoteAddr.
+// util.GetIP only splits an address and knows nothing about proxies.
 func (l *LuxContext) GetRemoteIP() string {
-	i := 0
-	end := -1
-	addr := l.Request.RemoteAddr
-	for i < len(addr) {
-		if addr[i] == ':' {
-			end = i
-		}
-		i++
-	}
-	if end == -1 {
-		return ""
+	if l.ClientIP != "" {
+		return l.ClientIP
 	}
-	return addr[:end]
+	return util.GetIP(l.Request.RemoteAddr)
 }
 
 func (l *LuxContext) GetRemotePort() string {
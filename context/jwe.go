@@ -0,0 +1,132 @@
+package context
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+const (
+	jweAlgorithm  = "dir"
+	jweEncryption = "A256GCM"
+	jweKeySize    = 32
+)
+
+var (
+	ErrInvalidJWE            = errors.New("invalid encrypted token")
+	ErrUnknownEncryptionKey  = errors.New("unknown encryption key id")
+	ErrInvalidEncryptionKey  = errors.New("encryption key must be 32 bytes for A256GCM")
+	errInvalidLegacyEncToken = errors.New("invalid legacy encrypted token")
+)
+
+type jweHeader struct {
+	Algorithm   string `json:"alg"`
+	Encryption  string `json:"enc"`
+	KeyID       string `json:"kid,omitempty"`
+	ContentType string `json:"cty,omitempty"`
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != jweKeySize {
+		return nil, ErrInvalidEncryptionKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptJWE wraps a signed token into a compact JWE using direct encryption with A256GCM.
+func EncryptJWE(plaintext []byte, key []byte, kid string) (string, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	header, err := json.Marshal(jweHeader{
+		Algorithm:   jweAlgorithm,
+		Encryption:  jweEncryption,
+		KeyID:       kid,
+		ContentType: "JWT",
+	})
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(header)
+
+	iv := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nil, iv, plaintext, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-aead.Overhead()], sealed[len(sealed)-aead.Overhead():]
+
+	return strings.Join([]string{
+		protected,
+		"",
+		base64.RawURLEncoding.EncodeToString(iv),
+		base64.RawURLEncoding.EncodeToString(ciphertext),
+		base64.RawURLEncoding.EncodeToString(tag),
+	}, "."), nil
+}
+
+// DecryptJWE opens a compact JWE produced by EncryptJWE, picking the key named by its kid header.
+// A token without kid is opened with defaultKID.
+func DecryptJWE(token string, keys map[string][]byte, defaultKID string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 || parts[1] != "" {
+		return nil, ErrInvalidJWE
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidJWE
+	}
+	header := jweHeader{}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, ErrInvalidJWE
+	}
+	if header.Algorithm != jweAlgorithm || header.Encryption != jweEncryption {
+		return nil, ErrInvalidJWE
+	}
+	kid := header.KeyID
+	if kid == "" {
+		kid = defaultKID
+	}
+	key, ok := keys[kid]
+	if !ok {
+		return nil, ErrUnknownEncryptionKey
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	iv, err1 := base64.RawURLEncoding.DecodeString(parts[2])
+	ciphertext, err2 := base64.RawURLEncoding.DecodeString(parts[3])
+	tag, err3 := base64.RawURLEncoding.DecodeString(parts[4])
+	if err1 != nil || err2 != nil || err3 != nil || len(iv) != aead.NonceSize() || len(tag) != aead.Overhead() {
+		return nil, ErrInvalidJWE
+	}
+	return aead.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+}
+
+// sealLegacy encrypts with a caller supplied AEAD, prefixing a random nonce and encoding the result as base64url.
+func sealLegacy(aead cipher.AEAD, plaintext []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+func openLegacy(aead cipher.AEAD, token []byte) ([]byte, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(string(token))
+	if err != nil || len(raw) < aead.NonceSize() {
+		return nil, errInvalidLegacyEncToken
+	}
+	return aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], nil)
+}
@@ -1,19 +1,47 @@
 package context
 
 import (
+	"context"
+	"crypto"
 	"crypto/cipher"
 	"errors"
+	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"net/http"
 	"strings"
+	"time"
 )
 
 const refreshTokenName = "refresh-token"
 
+// KeySet resolves verification keys by kid for tokens issued elsewhere, such as a jwks.Client.
+type KeySet interface {
+	Key(ctx context.Context, kid string) (any, error)
+}
+
 type JWTConfig struct {
-	SigningKey       []byte
-	SigningMethod    jwt.SigningMethod
-	EncryptionKey    []byte
+	// SigningKey is the HMAC secret for HS256, HS384 and HS512.
+	SigningKey []byte
+	// PrivateKey signs with RS256, ES256, EdDSA and the other asymmetric methods, and is used instead of SigningKey when set.
+	PrivateKey    crypto.Signer
+	SigningMethod jwt.SigningMethod
+	// SigningKeyID is written as the kid header of issued tokens.
+	SigningKeyID string
+	// AllowedAlgorithms pins the accepted alg headers. Empty means only SigningMethod.
+	AllowedAlgorithms []string
+	// VerificationKeys holds public keys or HMAC secrets by kid, for rotated or foreign keys.
+	VerificationKeys map[string]any
+	// KeySet resolves kids that are not in VerificationKeys.
+	KeySet KeySet
+	// EncryptionKeys holds 32-byte A256GCM keys by key id. When set, tokens are issued as compact JWE
+	// with the EncryptionKeyID key, and decrypted with the key named by their kid header,
+	// so retired keys can stay here until the tokens they issued expire.
+	EncryptionKeys  map[string][]byte
+	EncryptionKeyID string
+	// Deprecated: EncryptionKey was used as a fixed nonce and is ignored. Use EncryptionKeys.
+	EncryptionKey []byte
+	// Deprecated: use EncryptionKeys. When EncryptionKeys is empty, tokens are sealed with this AEAD
+	// under a random nonce and encoded as base64url.
 	EncryptionMethod cipher.AEAD
 	Domain           string
 	Path             string
@@ -22,8 +50,10 @@ type JWTConfig struct {
 type JWT struct {
 	response         *Response
 	request          *http.Request
-	encryptionNonce  []byte
+	encryptionKeys   map[string][]byte
+	encryptionKeyID  string
 	encryptionMethod cipher.AEAD
+	config           *JWTConfig
 	signingKey       []byte
 	signingMethod    jwt.SigningMethod
 	domain           string
@@ -38,8 +68,10 @@ func (l *LuxContext) JWT() *JWT {
 	j := new(JWT)
 	j.response = l.Response
 	j.request = l.Request
-	j.encryptionNonce = l.JWTConfig.EncryptionKey
+	j.encryptionKeys = l.JWTConfig.EncryptionKeys
+	j.encryptionKeyID = l.JWTConfig.EncryptionKeyID
 	j.encryptionMethod = l.JWTConfig.EncryptionMethod
+	j.config = l.JWTConfig
 	j.signingKey = l.JWTConfig.SigningKey
 	j.signingMethod = l.JWTConfig.SigningMethod
 	j.domain = l.JWTConfig.Domain
@@ -54,38 +86,47 @@ func (j *JWT) SetRefreshTokenWithClaims(claims jwt.Claims) (string, error) {
 		return "", err
 	}
 
-	ck := new(http.Cookie)
-	ck.Name = refreshTokenName
-	ck.Domain = j.domain
-	ck.Path = j.path
-	ck.HttpOnly = true
-	ck.Secure = true
-	ck.SameSite = http.SameSiteStrictMode
+	return j.SetRefreshTokenCookie(value, time.Time{}), nil
+}
 
+// SetRefreshTokenCookie sets an already made refresh token as cookie. A zero expires makes it a session cookie.
+func (j *JWT) SetRefreshTokenCookie(value string, expires time.Time) string {
+	ck := j.refreshTokenCookie()
 	ck.Value = value
+	ck.Expires = expires
 
 	refreshTokenValue := ck.String()
 
 	j.response.Header().Add("Set-Cookie", refreshTokenValue)
 
-	return refreshTokenValue, nil
+	return refreshTokenValue
 }
 
-func (j *JWT) MakeRefreshToken(claims jwt.Claims) (string, error) {
-	t := jwt.NewWithClaims(j.signingMethod, claims)
+func (j *JWT) ClearRefreshToken() {
+	ck := j.refreshTokenCookie()
+	ck.MaxAge = -1
+
+	j.response.Header().Add("Set-Cookie", ck.String())
+}
+
+func (j *JWT) refreshTokenCookie() *http.Cookie {
+	ck := new(http.Cookie)
+	ck.Name = refreshTokenName
+	ck.Domain = j.domain
+	ck.Path = j.path
+	ck.HttpOnly = true
+	ck.Secure = true
+	ck.SameSite = http.SameSiteStrictMode
+	return ck
+}
 
-	signed, err := t.SignedString(j.signingKey)
+func (j *JWT) MakeRefreshToken(claims jwt.Claims) (string, error) {
+	signed, err := j.sign(claims)
 	if err != nil {
 		return "", err
 	}
 
-	if j.encryptionMethod == nil {
-		return signed, nil
-	}
-
-	encrypted := j.encryptionMethod.Seal(nil, j.encryptionNonce, []byte(signed), nil)
-
-	return string(encrypted), nil
+	return j.encrypt(signed)
 }
 
 var errInvalidToken = errors.New("invalid token error")
@@ -102,17 +143,12 @@ func (j *JWT) GetRefreshTokenFromCookie() (jwt.Claims, error) {
 }
 
 func (j *JWT) ParseRefreshToken(token []byte) (jwt.Claims, error) {
-	if j.encryptionMethod != nil {
-		decrypted, err := j.encryptionMethod.Open(nil, j.encryptionNonce, token, nil)
-		if err != nil {
-			return nil, err
-		}
-		token = decrypted
+	token, err := j.decrypt(token)
+	if err != nil {
+		return nil, err
 	}
 
-	tk, err := jwt.Parse(string(token), func(token *jwt.Token) (interface{}, error) {
-		return j.signingKey, nil
-	})
+	tk, err := j.parse(token)
 	if err != nil {
 		return nil, err
 	}
@@ -136,41 +172,31 @@ func (j *JWT) SetAccessToken(claims jwt.Claims) (string, error) {
 }
 
 func (j *JWT) MakeAccessToken(claims jwt.Claims) (string, error) {
-	tk := jwt.NewWithClaims(j.signingMethod, claims)
-
-	signed, err := tk.SignedString(j.signingKey)
+	signed, err := j.sign(claims)
 	if err != nil {
 		return "", err
 	}
 
-	if j.encryptionMethod != nil {
-		value := j.encryptionMethod.Seal(nil, j.encryptionNonce, []byte(signed), nil)
-		signed = string(value)
-	}
-
-	return signed, nil
+	return j.encrypt(signed)
 }
 
 func (j *JWT) GetAccessToken() (jwt.Claims, error) {
 	value := j.request.Header.Get("Authorization")
-	value = strings.TrimPrefix(value, "Bearer")
+	if len(value) >= 6 && strings.EqualFold(value[:6], "Bearer") {
+		value = value[6:]
+	}
 	value = strings.TrimSpace(value)
 
 	return j.ParseAccessToken([]byte(value))
 }
 
 func (j *JWT) ParseAccessToken(tk []byte) (jwt.Claims, error) {
-	if j.encryptionMethod != nil {
-		decrypted, err := j.encryptionMethod.Open(nil, j.encryptionNonce, tk, nil)
-		if err != nil {
-			return nil, err
-		}
-		tk = decrypted
+	tk, err := j.decrypt(tk)
+	if err != nil {
+		return nil, err
 	}
 
-	t, err := jwt.Parse(string(tk), func(token *jwt.Token) (interface{}, error) {
-		return j.signingKey, nil
-	})
+	t, err := j.parse(tk)
 	if err != nil {
 		return nil, err
 	}
@@ -181,3 +207,81 @@ func (j *JWT) ParseAccessToken(tk []byte) (jwt.Claims, error) {
 
 	return t.Claims, nil
 }
+
+func (j *JWT) encrypt(signed string) (string, error) {
+	if len(j.encryptionKeys) > 0 {
+		key, ok := j.encryptionKeys[j.encryptionKeyID]
+		if !ok {
+			return "", ErrUnknownEncryptionKey
+		}
+		return EncryptJWE([]byte(signed), key, j.encryptionKeyID)
+	}
+	if j.encryptionMethod != nil {
+		return sealLegacy(j.encryptionMethod, []byte(signed))
+	}
+	return signed, nil
+}
+
+func (j *JWT) decrypt(token []byte) ([]byte, error) {
+	if len(j.encryptionKeys) > 0 {
+		return DecryptJWE(string(token), j.encryptionKeys, j.encryptionKeyID)
+	}
+	if j.encryptionMethod != nil {
+		return openLegacy(j.encryptionMethod, token)
+	}
+	return token, nil
+}
+
+var errNoAllowedAlgorithms = errors.New("no allowed signing algorithms configured")
+
+func (j *JWT) sign(claims jwt.Claims) (string, error) {
+	t := jwt.NewWithClaims(j.signingMethod, claims)
+	if j.config.SigningKeyID != "" {
+		t.Header["kid"] = j.config.SigningKeyID
+	}
+	if j.config.PrivateKey != nil {
+		return t.SignedString(j.config.PrivateKey)
+	}
+	return t.SignedString(j.signingKey)
+}
+
+func (j *JWT) allowedAlgorithms() []string {
+	if len(j.config.AllowedAlgorithms) > 0 {
+		return j.config.AllowedAlgorithms
+	}
+	if j.signingMethod != nil {
+		return []string{j.signingMethod.Alg()}
+	}
+	return nil
+}
+
+func (j *JWT) parse(token []byte) (*jwt.Token, error) {
+	allowed := j.allowedAlgorithms()
+	if len(allowed) == 0 {
+		return nil, errNoAllowedAlgorithms
+	}
+	return jwt.Parse(string(token), j.verificationKey, jwt.WithValidMethods(allowed))
+}
+
+// verificationKey picks the key by kid: VerificationKeys, then KeySet, then the own signing key.
+// The alg header is already pinned by the parser, and each method rejects keys of the wrong type.
+func (j *JWT) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid != "" && kid != j.config.SigningKeyID {
+		if key, ok := j.config.VerificationKeys[kid]; ok {
+			return key, nil
+		}
+		if j.config.KeySet != nil {
+			ctx := context.Background()
+			if j.request != nil {
+				ctx = j.request.Context()
+			}
+			return j.config.KeySet.Key(ctx, kid)
+		}
+		return nil, fmt.Errorf("unknown signing key id %q", kid)
+	}
+	if j.config.PrivateKey != nil {
+		return j.config.PrivateKey.Public(), nil
+	}
+	return j.signingKey, nil
+}
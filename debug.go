@@ -0,0 +1,109 @@
+package lux
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/middleware"
+)
+
+var startedAt = time.Now()
+
+type RuntimeStats struct {
+	GoVersion    string                     `json:"go_version"`
+	GOOS         string                     `json:"goos"`
+	GOARCH       string                     `json:"goarch"`
+	NumCPU       int                        `json:"num_cpu"`
+	GOMAXPROCS   int                        `json:"gomaxprocs"`
+	NumGoroutine int                        `json:"num_goroutine"`
+	NumCgoCall   int64                      `json:"num_cgo_call"`
+	Uptime       string                     `json:"uptime"`
+	MemStats     runtime.MemStats           `json:"memstats"`
+	Vars         map[string]json.RawMessage `json:"vars,omitempty"`
+}
+
+func (l *Lux) EnableDebug(path string, middlewares ...middleware.Set) {
+	rg := l.NewRouterGroup(path, middlewares...)
+
+	rg.GET("/pprof/*profile", func(lc *context.LuxContext) error {
+		profile := strings.Trim(lc.GetPathVariable("profile"), "/")
+		switch profile {
+		case "":
+			pprof.Index(lc.Response, lc.Request)
+		case "cmdline":
+			pprof.Cmdline(lc.Response, lc.Request)
+		case "profile":
+			pprof.Profile(lc.Response, lc.Request)
+		case "symbol":
+			pprof.Symbol(lc.Response, lc.Request)
+		case "trace":
+			pprof.Trace(lc.Response, lc.Request)
+		default:
+			pprof.Handler(profile).ServeHTTP(lc.Response, lc.Request)
+		}
+		return nil
+	}, nil)
+
+	rg.GET("/goroutines", func(lc *context.LuxContext) error {
+		buf := make([]byte, 1<<20)
+		for {
+			n := runtime.Stack(buf, true)
+			if n < len(buf) {
+				buf = buf[:n]
+				break
+			}
+			buf = make([]byte, len(buf)*2)
+		}
+		return lc.ReplyPlainText(string(buf))
+	}, nil)
+
+	rg.GET("/runtime", func(lc *context.LuxContext) error {
+		stats := RuntimeStats{
+			GoVersion:    runtime.Version(),
+			GOOS:         runtime.GOOS,
+			GOARCH:       runtime.GOARCH,
+			NumCPU:       runtime.NumCPU(),
+			GOMAXPROCS:   runtime.GOMAXPROCS(0),
+			NumGoroutine: runtime.NumGoroutine(),
+			NumCgoCall:   runtime.NumCgoCall(),
+			Uptime:       time.Since(startedAt).String(),
+			Vars:         map[string]json.RawMessage{},
+		}
+		runtime.ReadMemStats(&stats.MemStats)
+		expvar.Do(func(kv expvar.KeyValue) {
+			if kv.Key == "memstats" {
+				return
+			}
+			stats.Vars[kv.Key] = json.RawMessage(kv.Value.String())
+		})
+		return replyDebugJSON(lc, stats)
+	}, nil)
+
+	rg.GET("/routes", func(lc *context.LuxContext) error {
+		return replyDebugJSON(lc, l.Routes())
+	}, nil)
+
+	rg.GET("/build", func(lc *context.LuxContext) error {
+		info, ok := debug.ReadBuildInfo()
+		if !ok {
+			lc.SetStatus(http.StatusNotFound)
+			return lc.ReplyPlainText("build info is not available")
+		}
+		return replyDebugJSON(lc, info)
+	}, nil)
+
+	l.logger.Warn().Str("path", path).Msg("Debug endpoints are available")
+}
+
+func replyDebugJSON(lc *context.LuxContext, v any) error {
+	lc.Response.Headers.Set("Cache-Control", "no-store")
+	lc.Response.Headers.Set("Content-Type", "application/json")
+	return lc.ReplyJSON(v)
+}
@@ -9,19 +9,26 @@ import (
 	"github.com/gobwas/ws"
 	"github.com/julienschmidt/httprouter"
 	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/metrics"
+	"github.com/snowmerak/lux/trace"
 )
 
 type Handler func(*context.LuxContext) error
 
-func Wrap(ctx ctx.Context, logger *zerolog.Logger, jwtCfg *context.JWTConfig, handler Handler) func(http.ResponseWriter, *http.Request, httprouter.Params) {
+func Wrap(ctx ctx.Context, logger *zerolog.Logger, jwtCfg *context.JWTConfig, route string, handler Handler) func(http.ResponseWriter, *http.Request, httprouter.Params) {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		luxCtx := new(context.LuxContext)
-		luxCtx.Context = ctx
-		luxCtx.RequestContext = r.Context()
+		luxCtx, ok := context.FromContext(r.Context())
+		if !ok {
+			luxCtx = new(context.LuxContext)
+			luxCtx.Context = ctx
+			luxCtx.Logger = logger
+			luxCtx.JWTConfig = jwtCfg
+		}
+		// RequestContext already carries what the global middlewares stored, so it is only seeded here.
+		if luxCtx.RequestContext == nil {
+			luxCtx.RequestContext = r.Context()
+		}
 		luxCtx.Request = r
-		luxCtx.Logger = logger
-		luxCtx.JWTConfig = jwtCfg
-		ok := false
 		luxCtx.Response, ok = w.(*context.Response)
 		if !ok {
 			logger.Error().Str("method", r.Method).Str("path", r.URL.Path).Msg("Response is not a context.Response")
@@ -29,21 +36,37 @@ func Wrap(ctx ctx.Context, logger *zerolog.Logger, jwtCfg *context.JWTConfig, ha
 			return
 		}
 		luxCtx.RouteParams = ps
-		if err := handler(luxCtx); err != nil {
-			logger.Error().Str("method", r.Method).Str("path", r.URL.Path).Str("remote", r.RemoteAddr).Err(err).Msg("Handler error")
+		luxCtx.RoutePattern = route
+		parent := trace.SpanFromContext(luxCtx.RequestContext)
+		if parent != nil {
+			parent.SetName(r.Method + " " + route)
+			parent.SetAttribute("http.route", route)
+		}
+		spanCtx, span := trace.StartChild(luxCtx.RequestContext, "handler")
+		luxCtx.RequestContext = spanCtx
+		err := handler(luxCtx)
+		if span != nil {
+			luxCtx.RequestContext = trace.ContextWithSpan(luxCtx.RequestContext, parent)
+		}
+		span.RecordError(err)
+		span.End()
+		if err != nil {
+			logger.Error().Str("method", r.Method).Str("path", r.URL.Path).Str("remote", luxCtx.GetRemoteIP()).Err(err).Msg("Handler error")
 		}
 	}
 }
 
 type WSHandler func(*context.WSContext) error
 
-func WSWrap(wsHandler WSHandler) Handler {
+func WSWrap(wsHandler WSHandler, m *metrics.Metrics) Handler {
 	return func(luxCtx *context.LuxContext) error {
 		conn, _, _, err := ws.UpgradeHTTP(luxCtx.Request, luxCtx.Response)
 		if err != nil {
 			return err
 		}
 		defer conn.Close()
+		m.WebsocketOpened()
+		defer m.WebsocketClosed()
 		wsCtx := new(context.WSContext)
 		wsCtx.Conn = conn
 		if err := wsHandler(wsCtx); err != nil {
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	ctx "context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/trace"
+)
+
+type recorder struct {
+	lock  sync.Mutex
+	spans []trace.SpanData
+}
+
+func (r *recorder) Export(_ ctx.Context, spans []trace.SpanData) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func (r *recorder) Shutdown(ctx.Context) error { return nil }
+
+type middlewareKey struct{}
+
+func TestWrapKeepsMiddlewareContext(t *testing.T) {
+	rec := &recorder{}
+	tracer := trace.NewTracer("api", rec)
+
+	lc := &context.LuxContext{Response: context.NewResponse()}
+	r := httptest.NewRequest(http.MethodGet, "/items/1", nil)
+	spanCtx, server := tracer.Start(context.WithLuxContext(r.Context(), lc), http.MethodGet, trace.KindServer)
+	lc.Request = r.WithContext(spanCtx)
+	// A global middleware stores a value after the server span started.
+	lc.RequestContext = ctx.WithValue(spanCtx, middlewareKey{}, "alice")
+
+	var seen any
+	var active *trace.Span
+	logger := zerolog.Nop()
+	Wrap(ctx.Background(), &logger, nil, "/items/:id", func(l *context.LuxContext) error {
+		seen = l.RequestContext.Value(middlewareKey{})
+		active = trace.SpanFromContext(l.RequestContext)
+		return nil
+	})(lc.Response, lc.Request, nil)
+	server.End()
+
+	if seen != "alice" {
+		t.Errorf("handler saw %v, want the middleware value", seen)
+	}
+	if active == nil || active == server {
+		t.Errorf("handler did not run under its own span")
+	}
+	if got := lc.RequestContext.Value(middlewareKey{}); got != "alice" {
+		t.Errorf("RequestContext after the handler has %v, want the middleware value", got)
+	}
+	if got := trace.SpanFromContext(lc.RequestContext); got != server {
+		t.Errorf("active span after the handler is not the server span")
+	}
+
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	if len(rec.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(rec.spans))
+	}
+	handlerSpan, serverSpan := rec.spans[0], rec.spans[1]
+	if serverSpan.Name != "GET /items/:id" || serverSpan.Attributes["http.route"] != "/items/:id" {
+		t.Errorf("server span = %q %v", serverSpan.Name, serverSpan.Attributes)
+	}
+	if handlerSpan.Name != "handler" || handlerSpan.ParentSpanID != serverSpan.SpanID {
+		t.Errorf("handler span = %q with parent %s, want a child of %s", handlerSpan.Name, handlerSpan.ParentSpanID, serverSpan.SpanID)
+	}
+}
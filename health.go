@@ -0,0 +1,73 @@
+package lux
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/health"
+	"github.com/snowmerak/lux/middleware"
+	"github.com/snowmerak/lux/provider"
+)
+
+func (l *Lux) SetProvider(p *provider.Provider) {
+	l.health.AddProvider(p)
+}
+
+func (l *Lux) AddHealthCheck(name string, check health.CheckFunc) {
+	l.health.Add(name, check)
+}
+
+func (l *Lux) SetHealthCheckTimeout(timeout time.Duration) {
+	l.health.SetTimeout(timeout)
+}
+
+func (l *Lux) IsReady() bool {
+	return l.ready.Load() && !l.draining.Load()
+}
+
+func (l *Lux) EnableHealth(path string, middlewares ...middleware.Set) {
+	rg := l.NewRouterGroup(path, middlewares...)
+
+	rg.GET("/livez", func(lc *context.LuxContext) error {
+		return replyReport(lc, health.Report{Status: health.StatusOK})
+	}, nil)
+
+	rg.GET("/readyz", func(lc *context.LuxContext) error {
+		if !l.IsReady() {
+			report := health.Report{
+				Status: health.StatusFail,
+				Checks: map[string]health.Result{
+					"lifecycle": {Status: health.StatusFail, Error: l.lifecycleState()},
+				},
+			}
+			return replyReport(lc, report)
+		}
+		return replyReport(lc, l.health.Run(lc.RequestContext))
+	}, nil)
+
+	rg.GET("/healthz", func(lc *context.LuxContext) error {
+		return replyReport(lc, l.health.Run(lc.RequestContext))
+	}, nil)
+
+	l.logger.Info().Str("path", path).Msg("Health checks are available")
+}
+
+func (l *Lux) lifecycleState() string {
+	switch {
+	case l.draining.Load():
+		return "draining"
+	case !l.ready.Load():
+		return "starting"
+	}
+	return "serving"
+}
+
+func replyReport(lc *context.LuxContext, report health.Report) error {
+	if report.Status != health.StatusOK {
+		lc.SetStatus(http.StatusServiceUnavailable)
+	}
+	lc.Response.Headers.Set("Cache-Control", "no-store")
+	lc.Response.Headers.Set("Content-Type", "application/json")
+	return lc.ReplyJSON(report)
+}
@@ -0,0 +1,138 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/snowmerak/lux/provider"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+const DefaultTimeout = 5 * time.Second
+
+var ErrTimeout = errors.New("health check timed out")
+
+type CheckFunc func(ctx context.Context) error
+
+type Result struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+type Health struct {
+	lock      sync.RWMutex
+	timeout   time.Duration
+	checks    map[string]CheckFunc
+	providers []*provider.Provider
+}
+
+func New(timeout time.Duration) *Health {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Health{
+		timeout: timeout,
+		checks:  map[string]CheckFunc{},
+	}
+}
+
+func (h *Health) SetTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.timeout = timeout
+}
+
+func (h *Health) Add(name string, check CheckFunc) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.checks[name] = check
+}
+
+// AddProvider contributes every component of p that implements provider.HealthChecker.
+// Components are looked up on each run, so ones constructed later are included.
+func (h *Health) AddProvider(p *provider.Provider) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.providers = append(h.providers, p)
+}
+
+func (h *Health) Run(ctx context.Context) Report {
+	h.lock.RLock()
+	timeout := h.timeout
+	checks := make(map[string]CheckFunc, len(h.checks))
+	for name, check := range h.checks {
+		checks[name] = check
+	}
+	for _, p := range h.providers {
+		for name, checker := range p.HealthCheckers() {
+			checks[name] = checker.HealthCheck
+		}
+	}
+	h.lock.RUnlock()
+
+	report := Report{
+		Status: StatusOK,
+		Checks: make(map[string]Result, len(checks)),
+	}
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check CheckFunc) {
+			defer wg.Done()
+			result := run(ctx, timeout, check)
+			lock.Lock()
+			defer lock.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusOK {
+				report.Status = StatusFail
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func run(ctx context.Context, timeout time.Duration, check CheckFunc) Result {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ErrTimeout
+	}
+
+	result := Result{
+		Status:   StatusOK,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
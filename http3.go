@@ -0,0 +1,132 @@
+package lux
+
+import (
+	ctx "context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// SetQUICConfig tunes the QUIC transport of the HTTP/3 listeners, e.g. MaxIdleTimeout and MaxIncomingStreams.
+func (l *Lux) SetQUICConfig(cfg *quic.Config) {
+	l.quicConfig = cfg
+}
+
+// ListenAndServe3 serves HTTP/3 on the UDP port of addr next to HTTP/1.1 and HTTP/2 on the TCP port.
+// TCP responses advertise HTTP/3 with an Alt-Svc header.
+func (l *Lux) ListenAndServe3(ctx ctx.Context, addr string, certFile string, keyFile string) error {
+	l.buildServer(ctx, addr)
+	if err := l.configureHTTP2(); err != nil {
+		l.logger.Fatal().Str("error", err.Error()).Msg("Http2 configuration error")
+		return err
+	}
+	tlsConfig := l.TLSConfig().Clone()
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			l.logger.Fatal().Str("error", err.Error()).Msg("Http3 certificate error")
+			return err
+		}
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+	}
+	closeHTTP3, err := l.startHTTP3(addr, tlsConfig)
+	if err != nil {
+		l.logger.Fatal().Str("error", err.Error()).Msg("Listen and serve http3 error")
+		return err
+	}
+	if err := l.serve(ctx, addr, func(ln net.Listener) error {
+		return l.server.ServeTLS(ln, certFile, keyFile)
+	}); err != nil {
+		closeHTTP3()
+		l.logger.Fatal().Str("error", err.Error()).Msg("Listen and serve http3 TLS error")
+		return err
+	}
+	return nil
+}
+
+func (l *Lux) ListenAndServe3AutoTLS(ctx ctx.Context, domains []string) error {
+	if err := l.configureHTTP2(); err != nil {
+		l.logger.Fatal().Str("error", err.Error()).Msg("Http2 configuration error")
+		return err
+	}
+	if err := l.serveAutoTLS(ctx, domains, true); err != nil {
+		l.logger.Fatal().Str("error", err.Error()).Msg("Listen and serve http3 Auto TLS error")
+		return err
+	}
+	return nil
+}
+
+// startHTTP3 serves Lux over QUIC on the UDP port of addr. It must run after buildServer,
+// since it wraps the TCP handler to add Alt-Svc. In-flight HTTP/3 requests are drained on Shutdown.
+// The returned func closes the server and its socket at once, for when the TCP side fails to start.
+func (l *Lux) startHTTP3(addr string, tlsConfig *tls.Config) (func(), error) {
+	if addr == "" {
+		addr = ":https"
+	}
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	requests := new(inflight)
+	server := &http3.Server{
+		Addr:           addr,
+		Handler:        requests.track(l),
+		TLSConfig:      tlsConfig,
+		QuicConfig:     l.quicConfig,
+		MaxHeaderBytes: l.server.MaxHeaderBytes,
+	}
+	next := l.server.Handler
+	l.server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.SetQuicHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+	// quic-go leaves a caller-owned PacketConn open, so the port is released here.
+	closeAll := func() error {
+		err := server.Close()
+		if cerr := conn.Close(); cerr != nil && err == nil && !errors.Is(cerr, net.ErrClosed) {
+			err = cerr
+		}
+		return err
+	}
+	l.addShutdownHook(func(ctx ctx.Context) error {
+		requests.wait(ctx)
+		return closeAll()
+	})
+	go func() {
+		if err := server.Serve(conn); err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, quic.ErrServerClosed) {
+			l.logger.Error().Str("error", err.Error()).Msg("Http3 server error")
+		}
+	}()
+	return func() { closeAll() }, nil
+}
+
+// inflight counts running requests, because http3.Server cannot close gracefully.
+type inflight struct {
+	n atomic.Int64
+}
+
+func (f *inflight) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.n.Add(1)
+		defer f.n.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *inflight) wait(ctx ctx.Context) {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for f.n.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
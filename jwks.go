@@ -0,0 +1,66 @@
+package lux
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/jwks"
+	"github.com/snowmerak/lux/middleware"
+)
+
+// ServeJWKS publishes the public keys of the JWT config: PrivateKey under SigningKeyID,
+// and every public key in VerificationKeys. HMAC secrets are never published.
+func (l *Lux) ServeJWKS(path string, middlewares ...middleware.Set) {
+	rg := l.NewRouterGroup(path, middlewares...)
+	rg.GET("", func(lc *context.LuxContext) error {
+		set, err := l.jwkSet()
+		if err != nil {
+			lc.SetInternalServerError()
+			return err
+		}
+		body, err := json.Marshal(set)
+		if err != nil {
+			lc.SetInternalServerError()
+			return err
+		}
+		lc.Response.Headers.Set("Content-Type", jwks.ContentType)
+		lc.Response.Headers.Set("Cache-Control", "public, max-age=300")
+		lc.Response.Body = body
+		lc.SetOK()
+		return nil
+	}, nil)
+
+	l.logger.Info().Str("path", path).Msg("JWKS is available")
+}
+
+func (l *Lux) jwkSet() (*jwks.Set, error) {
+	set := &jwks.Set{Keys: []jwks.Key{}}
+	cfg := l.jwtConfig
+	if cfg == nil {
+		return set, nil
+	}
+	if cfg.PrivateKey != nil {
+		alg := ""
+		if cfg.SigningMethod != nil {
+			alg = cfg.SigningMethod.Alg()
+		}
+		if err := set.Add(cfg.SigningKeyID, alg, cfg.PrivateKey.Public()); err != nil {
+			return nil, err
+		}
+	}
+	kids := make([]string, 0, len(cfg.VerificationKeys))
+	for kid := range cfg.VerificationKeys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	for _, kid := range kids {
+		if kid == cfg.SigningKeyID {
+			continue
+		}
+		if err := set.Add(kid, "", cfg.VerificationKeys[kid]); err != nil && err != jwks.ErrUnsupportedKeyType {
+			return nil, err
+		}
+	}
+	return set, nil
+}
@@ -0,0 +1,172 @@
+package jwks
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCacheTTL        = 10 * time.Minute
+	DefaultRefreshInterval = time.Minute
+)
+
+type ClientConfig struct {
+	URL    string
+	Client *http.Client
+	// CacheTTL is how long a fetched set is used before it is fetched again. Zero means DefaultCacheTTL.
+	CacheTTL time.Duration
+	// RefreshInterval is the shortest time between fetches caused by an unknown kid, which keeps
+	// tokens with made-up key ids from hammering the issuer. Zero means DefaultRefreshInterval.
+	RefreshInterval time.Duration
+}
+
+// fetchTimeout bounds a fetch, which runs detached from the request that started it.
+const fetchTimeout = 30 * time.Second
+
+// Client fetches and caches a remote JWKS. It satisfies context.KeySet.
+// Fetches run outside the lock, one at a time, so a slow issuer only delays the requests that need new keys.
+// After a failed fetch, the next one waits RefreshInterval and cached keys keep being served.
+type Client struct {
+	cfg ClientConfig
+
+	lock      sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	failedAt  time.Time
+	lastErr   error
+	fetching  chan struct{}
+}
+
+func NewClient(cfg ClientConfig) *Client {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = DefaultCacheTTL
+	}
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = DefaultRefreshInterval
+	}
+	return &Client{cfg: cfg}
+}
+
+func (c *Client) Key(ctx context.Context, kid string) (any, error) {
+	c.lock.Lock()
+	age := time.Since(c.fetchedAt)
+	key, ok := c.keys[kid]
+	if ok && age < c.cfg.CacheTTL {
+		c.lock.Unlock()
+		return key, nil
+	}
+	stale := c.keys == nil || age >= c.cfg.CacheTTL || age >= c.cfg.RefreshInterval
+	backoff := time.Since(c.failedAt) < c.cfg.RefreshInterval
+	if !stale || backoff {
+		err := c.lastErr
+		c.lock.Unlock()
+		if ok {
+			return key, nil
+		}
+		if backoff && err != nil {
+			return nil, err
+		}
+		return nil, ErrKeyNotFound
+	}
+	done := c.startFetch()
+	c.lock.Unlock()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	if c.lastErr != nil {
+		return nil, c.lastErr
+	}
+	return nil, ErrKeyNotFound
+}
+
+// Refresh fetches the set now, or waits for the fetch already running.
+func (c *Client) Refresh(ctx context.Context) error {
+	c.lock.Lock()
+	done := c.startFetch()
+	c.lock.Unlock()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lastErr
+}
+
+// startFetch starts a fetch unless one is running and returns a channel closed when it ends.
+// The caller holds c.lock.
+func (c *Client) startFetch() <-chan struct{} {
+	if c.fetching != nil {
+		return c.fetching
+	}
+	done := make(chan struct{})
+	c.fetching = done
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+		keys, err := c.fetch(ctx)
+		cancel()
+		c.lock.Lock()
+		if err != nil {
+			c.failedAt = time.Now()
+		} else {
+			c.keys = keys
+			c.fetchedAt = time.Now()
+		}
+		c.lastErr = err
+		c.fetching = nil
+		c.lock.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+func (c *Client) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ContentType+", application/json")
+	resp, err := c.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: fetching %s: %s", c.cfg.URL, resp.Status)
+	}
+
+	set := Set{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.KeyID] = pub
+	}
+	return keys, nil
+}
@@ -0,0 +1,266 @@
+package jwks
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// issuer serves a JWKS that tests can rotate, fail or stall.
+type issuer struct {
+	t       *testing.T
+	lock    sync.Mutex
+	set     Set
+	status  int
+	release chan struct{}
+	fetches atomic.Int32
+}
+
+func newIssuer(t *testing.T) (*issuer, *httptest.Server) {
+	is := &issuer{t: t, status: http.StatusOK}
+	server := httptest.NewServer(is)
+	t.Cleanup(server.Close)
+	return is, server
+}
+
+func (is *issuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	is.fetches.Add(1)
+	is.lock.Lock()
+	set, status, release := is.set, is.status, is.release
+	is.lock.Unlock()
+	if release != nil {
+		<-release
+	}
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	json.NewEncoder(w).Encode(set)
+}
+
+// rotate replaces the served keys with new Ed25519 keys and returns them by kid.
+func (is *issuer) rotate(kids ...string) map[string]ed25519.PublicKey {
+	keys := map[string]ed25519.PublicKey{}
+	set := Set{}
+	for _, kid := range kids {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			is.t.Fatal(err)
+		}
+		if err := set.Add(kid, "EdDSA", pub); err != nil {
+			is.t.Fatal(err)
+		}
+		keys[kid] = pub
+	}
+	is.lock.Lock()
+	is.set = set
+	is.lock.Unlock()
+	return keys
+}
+
+func (is *issuer) fail(status int) {
+	is.lock.Lock()
+	is.status = status
+	is.lock.Unlock()
+}
+
+func (is *issuer) stall() chan struct{} {
+	release := make(chan struct{})
+	is.lock.Lock()
+	is.release = release
+	is.lock.Unlock()
+	return release
+}
+
+func sameKey(t *testing.T, got any, want ed25519.PublicKey) {
+	t.Helper()
+	pub, ok := got.(ed25519.PublicKey)
+	if !ok || !pub.Equal(want) {
+		t.Fatalf("got key %v, want %v", got, want)
+	}
+}
+
+func TestClientCachesKeys(t *testing.T) {
+	is, server := newIssuer(t)
+	keys := is.rotate("a", "b")
+	client := NewClient(ClientConfig{URL: server.URL})
+
+	for _, kid := range []string{"a", "b", "a"} {
+		key, err := client.Key(context.Background(), kid)
+		if err != nil {
+			t.Fatalf("Key(%q): %v", kid, err)
+		}
+		sameKey(t, key, keys[kid])
+	}
+	if n := is.fetches.Load(); n != 1 {
+		t.Fatalf("fetched %d times, want 1", n)
+	}
+}
+
+func TestClientUnknownKidWaitsForRefreshInterval(t *testing.T) {
+	is, server := newIssuer(t)
+	is.rotate("a")
+	client := NewClient(ClientConfig{URL: server.URL, RefreshInterval: time.Hour})
+
+	if _, err := client.Key(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := client.Key(context.Background(), "made-up"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Key(made-up) = %v, want ErrKeyNotFound", err)
+		}
+	}
+	if n := is.fetches.Load(); n != 1 {
+		t.Fatalf("fetched %d times, want 1", n)
+	}
+}
+
+func TestClientPicksUpRotatedKeys(t *testing.T) {
+	is, server := newIssuer(t)
+	old := is.rotate("old")
+	client := NewClient(ClientConfig{URL: server.URL, RefreshInterval: 10 * time.Millisecond})
+
+	key, err := client.Key(context.Background(), "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameKey(t, key, old["old"])
+
+	rotated := is.rotate("new")
+	time.Sleep(20 * time.Millisecond)
+	key, err = client.Key(context.Background(), "new")
+	if err != nil {
+		t.Fatalf("Key(new) after rotation: %v", err)
+	}
+	sameKey(t, key, rotated["new"])
+	if _, err := client.Key(context.Background(), "old"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("Key(old) after rotation = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestClientRefetchesAfterCacheTTL(t *testing.T) {
+	is, server := newIssuer(t)
+	is.rotate("a")
+	client := NewClient(ClientConfig{URL: server.URL, CacheTTL: 10 * time.Millisecond})
+
+	if _, err := client.Key(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	replaced := is.rotate("a")
+	time.Sleep(20 * time.Millisecond)
+	key, err := client.Key(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameKey(t, key, replaced["a"])
+	if n := is.fetches.Load(); n != 2 {
+		t.Fatalf("fetched %d times, want 2", n)
+	}
+}
+
+func TestClientBacksOffAfterFailure(t *testing.T) {
+	is, server := newIssuer(t)
+	is.fail(http.StatusInternalServerError)
+	client := NewClient(ClientConfig{URL: server.URL, RefreshInterval: time.Hour})
+
+	for i := 0; i < 3; i++ {
+		_, err := client.Key(context.Background(), "a")
+		if err == nil || errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("Key after a failed fetch = %v, want the fetch error", err)
+		}
+	}
+	if n := is.fetches.Load(); n != 1 {
+		t.Fatalf("fetched %d times during backoff, want 1", n)
+	}
+}
+
+func TestClientServesCachedKeysWhenIssuerFails(t *testing.T) {
+	is, server := newIssuer(t)
+	keys := is.rotate("a")
+	client := NewClient(ClientConfig{URL: server.URL, RefreshInterval: 10 * time.Millisecond})
+
+	if _, err := client.Key(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+	is.fail(http.StatusBadGateway)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := client.Key(context.Background(), "b"); err == nil {
+		t.Fatal("Key(b) succeeded while the issuer is down")
+	}
+	key, err := client.Key(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("cached Key(a) while the issuer is down: %v", err)
+	}
+	sameKey(t, key, keys["a"])
+	if err := client.Refresh(context.Background()); err == nil {
+		t.Fatal("Refresh succeeded while the issuer is down")
+	}
+}
+
+func TestClientSharesOneFetch(t *testing.T) {
+	is, server := newIssuer(t)
+	keys := is.rotate("a")
+	release := is.stall()
+	client := NewClient(ClientConfig{URL: server.URL})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key, err := client.Key(context.Background(), "a")
+			if err == nil && !key.(ed25519.PublicKey).Equal(keys["a"]) {
+				err = errors.New("wrong key")
+			}
+			errs <- err
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := is.fetches.Load(); n != 1 {
+		t.Fatalf("fetched %d times, want 1", n)
+	}
+}
+
+func TestClientSlowFetchDoesNotBlockCachedKeys(t *testing.T) {
+	is, server := newIssuer(t)
+	keys := is.rotate("a")
+	client := NewClient(ClientConfig{URL: server.URL, RefreshInterval: 10 * time.Millisecond})
+	if _, err := client.Key(context.Background(), "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	release := is.stall()
+	defer close(release)
+	time.Sleep(20 * time.Millisecond)
+	waiting, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Key(waiting, "b"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Key(b) during a stalled fetch = %v, want DeadlineExceeded", err)
+	}
+
+	cached, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	key, err := client.Key(cached, "a")
+	if err != nil {
+		t.Fatalf("cached Key(a) during a stalled fetch: %v", err)
+	}
+	sameKey(t, key, keys["a"])
+}
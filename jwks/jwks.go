@@ -0,0 +1,130 @@
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+const ContentType = "application/jwk-set+json"
+
+var (
+	ErrKeyNotFound        = errors.New("jwks: key not found")
+	ErrUnsupportedKeyType = errors.New("jwks: unsupported key type")
+)
+
+// Key is a public JSON Web Key for RSA, EC (P-256, P-384, P-521) or OKP (Ed25519).
+type Key struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type Set struct {
+	Keys []Key `json:"keys"`
+}
+
+func FromPublicKey(kid string, alg string, key crypto.PublicKey) (Key, error) {
+	k := Key{KeyID: kid, Use: "sig", Algorithm: alg}
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		k.KeyType = "RSA"
+		k.N = encode(pub.N.Bytes())
+		k.E = encode(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		k.KeyType = "EC"
+		k.Curve = pub.Curve.Params().Name
+		k.X = encode(pub.X.FillBytes(make([]byte, size)))
+		k.Y = encode(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		k.KeyType = "OKP"
+		k.Curve = "Ed25519"
+		k.X = encode(pub)
+	default:
+		return Key{}, ErrUnsupportedKeyType
+	}
+	return k, nil
+}
+
+func (k Key) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err1 := decode(k.N)
+		e, err2 := decode(k.E)
+		if err1 != nil || err2 != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("jwks: invalid RSA key %q", k.KeyID)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, ErrUnsupportedKeyType
+		}
+		x, err1 := decode(k.X)
+		y, err2 := decode(k.Y)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("jwks: invalid EC key %q", k.KeyID)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("jwks: invalid EC key %q", k.KeyID)
+		}
+		return pub, nil
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, ErrUnsupportedKeyType
+		}
+		x, err := decode(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("jwks: invalid OKP key %q", k.KeyID)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, ErrUnsupportedKeyType
+}
+
+func (s *Set) Add(kid string, alg string, key crypto.PublicKey) error {
+	k, err := FromPublicKey(kid, alg, key)
+	if err != nil {
+		return err
+	}
+	s.Keys = append(s.Keys, k)
+	return nil
+}
+
+func (s *Set) Lookup(kid string) (crypto.PublicKey, error) {
+	for _, k := range s.Keys {
+		if k.KeyID == kid && (k.Use == "" || k.Use == "sig") {
+			return k.PublicKey()
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,110 @@
+package lux
+
+import (
+	ctx "context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/snowmerak/lux/proxyproto"
+)
+
+// Listener describes one socket served by Serve.
+type Listener struct {
+	// Network is "tcp", "tcp4", "tcp6" or "unix". It is ignored when Listener is set.
+	Network string
+	Addr    string
+	// TLS serves TLS with CertFile and KeyFile, which may be empty when the Lux TLS config has certificates.
+	TLS      bool
+	CertFile string
+	KeyFile  string
+	// Listener is served as is instead of opening Network and Addr.
+	Listener net.Listener
+	// RedirectTo answers every request with a permanent redirect to HTTPS on this port instead of serving routes.
+	RedirectTo string
+}
+
+func ListenTCP(addr string) Listener {
+	return Listener{Network: "tcp", Addr: addr}
+}
+
+func ListenTLS(addr, certFile, keyFile string) Listener {
+	return Listener{Network: "tcp", Addr: addr, TLS: true, CertFile: certFile, KeyFile: keyFile}
+}
+
+func ListenUnix(path string) Listener {
+	return Listener{Network: "unix", Addr: path}
+}
+
+func ListenOn(ln net.Listener) Listener {
+	return Listener{Listener: ln}
+}
+
+// RedirectHTTPS listens on addr and redirects GET and HEAD requests to HTTPS on httpsPort. Empty means 443.
+func RedirectHTTPS(addr, httpsPort string) Listener {
+	if httpsPort == "" {
+		httpsPort = "443"
+	}
+	return Listener{Network: "tcp", Addr: addr, RedirectTo: httpsPort}
+}
+
+// Serve runs the routes on every listener until ctx is done. All listeners share one http.Server,
+// so timeouts, middlewares and Shutdown apply to each of them. When one listener fails, the others are shut down.
+func (l *Lux) Serve(ctx ctx.Context, listeners ...Listener) error {
+	if len(listeners) == 0 {
+		return errors.New("no listeners to serve")
+	}
+	lns := make([]net.Listener, 0, len(listeners))
+	closeAll := func() {
+		for _, ln := range lns {
+			ln.Close()
+		}
+	}
+	for _, spec := range listeners {
+		ln := spec.Listener
+		if ln == nil {
+			network := spec.Network
+			if network == "" {
+				network = "tcp"
+			}
+			var err error
+			ln, err = net.Listen(network, spec.Addr)
+			if err != nil {
+				closeAll()
+				return err
+			}
+			if l.proxyProto != nil && network != "unix" {
+				ln = proxyproto.NewListener(ln, l.proxyProto, l.server.ReadHeaderTimeout)
+			}
+		}
+		lns = append(lns, ln)
+	}
+
+	l.buildServer(ctx, lns[0].Addr().String())
+	if err := l.configureHTTP2(); err != nil {
+		closeAll()
+		return err
+	}
+	l.server.Handler = l.h2cHandler(l.server.Handler)
+
+	serves := make([]func() error, 0, len(lns))
+	for i, spec := range listeners {
+		ln, spec := lns[i], spec
+		switch {
+		case spec.RedirectTo != "":
+			redirect := &http.Server{
+				Handler:           httpsRedirect(spec.RedirectTo),
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			l.addShutdownHook(redirect.Shutdown)
+			serves = append(serves, func() error { return redirect.Serve(ln) })
+		case spec.TLS:
+			serves = append(serves, func() error { return l.server.ServeTLS(ln, spec.CertFile, spec.KeyFile) })
+		default:
+			serves = append(serves, func() error { return l.server.Serve(ln) })
+		}
+		l.logger.Info().Str("network", ln.Addr().Network()).Str("addr", ln.Addr().String()).Bool("tls", spec.TLS).Msg("Listening")
+	}
+	return l.run(ctx, serves...)
+}
@@ -3,21 +3,32 @@ package lux
 import (
 	ctx "context"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
 
-	"github.com/caddyserver/certmagic"
 	"github.com/julienschmidt/httprouter"
+	"github.com/quic-go/quic-go"
+	"github.com/snowmerak/lux/accesslog"
 	"github.com/snowmerak/lux/context"
 	"github.com/snowmerak/lux/handler"
+	"github.com/snowmerak/lux/health"
+	"github.com/snowmerak/lux/metrics"
 	"github.com/snowmerak/lux/middleware"
+	"github.com/snowmerak/lux/proxyproto"
 	"github.com/snowmerak/lux/router"
 	"github.com/snowmerak/lux/swagger"
+	"github.com/snowmerak/lux/trace"
+	"github.com/snowmerak/lux/util"
 	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 type Lux struct {
@@ -26,9 +37,28 @@ type Lux struct {
 	server      *http.Server
 	middlewares []middleware.Set
 	builtRouter *httprouter.Router
+	routeTable  []Route
 	swagger     *swagger.Swagger
 	jwtConfig   *context.JWTConfig
+	proxies     *util.TrustedProxies
+	proxyProto  *util.TrustedProxies
+	accessLog   *accesslog.AccessLog
+	metrics     *metrics.Metrics
+	tracer      *trace.Tracer
+	health      *health.Health
+	autoTLS     *AutoTLSConfig
+	http2       *http2.Server
+	quicConfig  *quic.Config
+	onShutdown  []func(ctx.Context) error
+	shutdownMu  sync.Mutex
 	ctx         ctx.Context
+
+	ready           atomic.Bool
+	draining        atomic.Bool
+	shutdownTimeout time.Duration
+	shutdownDelay   time.Duration
+	shutdownOnce    sync.Once
+	shutdownDone    chan struct{}
 }
 
 func New(swaggerInfo *swagger.Info, logger *zerolog.Logger, middlewares ...middleware.Set) *Lux {
@@ -44,6 +74,11 @@ func New(swaggerInfo *swagger.Info, logger *zerolog.Logger, middlewares ...middl
 		middlewares: middlewares,
 		builtRouter: httprouter.New(),
 		swagger:     swg,
+		metrics:     metrics.New(),
+		health:      health.New(health.DefaultTimeout),
+
+		shutdownTimeout: 30 * time.Second,
+		shutdownDone:    make(chan struct{}),
 	}
 }
 
@@ -71,6 +106,19 @@ func (l *Lux) SetMaxHeaderBytes(n int) {
 	l.server.MaxHeaderBytes = n
 }
 
+// SetHTTP2Config tunes HTTP/2 connections, e.g. MaxConcurrentStreams, MaxReadFrameSize and IdleTimeout.
+func (l *Lux) SetHTTP2Config(cfg *http2.Server) {
+	l.http2 = cfg
+}
+
+func (l *Lux) SetShutdownTimeout(duration time.Duration) {
+	l.shutdownTimeout = duration
+}
+
+func (l *Lux) SetShutdownDelay(duration time.Duration) {
+	l.shutdownDelay = duration
+}
+
 func (l *Lux) SetInfoEmail(email string) {
 	l.swagger.Info.Contact.Email = email
 }
@@ -80,10 +128,67 @@ func (l *Lux) SetInfoLicense(name, link string) {
 	l.swagger.Info.License.URL = link
 }
 
+func (l *Lux) SetTrustedProxies(cidrs ...string) error {
+	if len(cidrs) == 0 {
+		l.proxies = nil
+		return nil
+	}
+	proxies, err := util.NewTrustedProxies(cidrs...)
+	if err != nil {
+		return err
+	}
+	l.proxies = proxies
+	return nil
+}
+
+// SetProxyProtocol accepts PROXY protocol v1 and v2 headers on connections from the given CIDRs,
+// so Request.RemoteAddr is the client behind a TCP load balancer.
+func (l *Lux) SetProxyProtocol(trusted ...string) error {
+	if len(trusted) == 0 {
+		l.proxyProto = nil
+		return nil
+	}
+	proxies, err := util.NewTrustedProxies(trusted...)
+	if err != nil {
+		return err
+	}
+	l.proxyProto = proxies
+	return nil
+}
+
 func (l *Lux) SetJWTConfig(cfg *context.JWTConfig) {
 	l.jwtConfig = cfg
 }
 
+func (l *Lux) SetAccessLog(cfg *accesslog.Config) {
+	if cfg == nil {
+		l.accessLog = nil
+		return
+	}
+	l.accessLog = accesslog.New(*cfg)
+}
+
+func (l *Lux) SetTracer(tracer *trace.Tracer) {
+	l.tracer = tracer
+}
+
+func (l *Lux) Metrics() *metrics.Metrics {
+	return l.metrics
+}
+
+func (l *Lux) EnableMetrics(path string, middlewares ...middleware.Set) {
+	l.metrics.Enable()
+
+	rg := l.NewRouterGroup(path, middlewares...)
+	rg.GET("", func(lc *context.LuxContext) error {
+		lc.Response.Headers.Set("Content-Type", metrics.ContentType)
+		_, err := l.metrics.Registry().WriteTo(lc.Response)
+		return err
+	}, nil)
+
+	l.logger.Info().Str("path", path).Msg("Metrics are available")
+}
+
 func (l *Lux) ShowSwagger(path string, middlewares ...middleware.Set) {
 	swaggerjson, err := json.Marshal(l.swagger)
 	if err != nil {
@@ -106,12 +211,27 @@ func (l *Lux) ShowSwagger(path string, middlewares ...middleware.Set) {
 
 func (l *Lux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	luxCtx := new(context.LuxContext)
-	luxCtx.Request = r
 	luxCtx.Response = context.NewResponse()
 	luxCtx.JWTConfig = l.jwtConfig
 	luxCtx.Logger = l.logger
 	luxCtx.Context = l.ctx
-	luxCtx.RequestContext = r.Context()
+	luxCtx.Request = r.WithContext(context.WithLuxContext(r.Context(), luxCtx))
+	luxCtx.RequestContext = luxCtx.Request.Context()
+	if l.proxies != nil {
+		luxCtx.ClientIP = l.proxies.ClientIP(r)
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		luxCtx.ClientCert = context.NewCertIdentity(r.TLS.VerifiedChains[0][0])
+	}
+	if l.accessLog != nil {
+		defer l.accessLog.Begin(luxCtx).End()
+	}
+	if l.metrics.Enabled() {
+		defer l.metrics.Begin(luxCtx).End()
+	}
+	if l.tracer != nil {
+		defer l.startSpan(luxCtx).End()
+	}
 	defer func() {
 		for key, values := range luxCtx.Response.Headers {
 			for _, value := range values {
@@ -135,24 +255,158 @@ func (l *Lux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+type serverSpan struct {
+	span *trace.Span
+	lc   *context.LuxContext
+}
+
+func (l *Lux) startSpan(lc *context.LuxContext) serverSpan {
+	spanCtx := lc.Request.Context()
+	if sc, ok := trace.Extract(lc.Request.Header); ok {
+		spanCtx = trace.ContextWithRemote(spanCtx, sc)
+	}
+	spanCtx, span := l.tracer.Start(spanCtx, lc.Request.Method, trace.KindServer)
+	span.SetAttribute("http.method", lc.Request.Method)
+	span.SetAttribute("http.target", lc.Request.URL.RequestURI())
+	span.SetAttribute("user_agent.original", lc.Request.UserAgent())
+	lc.Request = lc.Request.WithContext(spanCtx)
+	lc.RequestContext = spanCtx
+	return serverSpan{span: span, lc: lc}
+}
+
+func (s serverSpan) End() {
+	status := s.lc.Response.StatusCode
+	s.span.SetAttribute("http.status_code", status)
+	if status >= 500 {
+		s.span.SetStatus(trace.StatusError, http.StatusText(status))
+	}
+	s.span.End()
+}
+
 func (l *Lux) buildServer(ctx ctx.Context, addr string) {
+	l.ctx = ctx
 	l.server.Addr = addr
 	l.server.Handler = l
 	l.builtRouter = new(httprouter.Router)
 	for _, routerGroup := range l.routers {
 		for path, routerMap := range routerGroup.Routers {
 			for method, router := range routerMap {
-				l.builtRouter.Handle(method, path, handler.Wrap(ctx, l.logger, l.jwtConfig, router.Handler))
+				l.builtRouter.Handle(method, path, handler.Wrap(ctx, l.logger, l.jwtConfig, path, router.Handler))
+				l.routeTable = append(l.routeTable, newRoute(method, path, routerGroup, router))
 			}
 		}
 	}
+	sortRoutes(l.routeTable)
 	l.routers = nil
 	l.logger.Info().Str("addr", addr).Msg("Server is ready to serve")
 }
 
+func (l *Lux) serve(ctx ctx.Context, addr string, serve func(ln net.Listener) error) error {
+	if addr == "" {
+		addr = ":http"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if l.proxyProto != nil {
+		ln = proxyproto.NewListener(ln, l.proxyProto, l.server.ReadHeaderTimeout)
+	}
+	return l.run(ctx, func() error { return serve(ln) })
+}
+
+// run calls every serve function until ctx is done. When one of them fails, the server is shut down,
+// which also stops the others and runs the shutdown hooks, and the first error is reported.
+func (l *Lux) run(ctx ctx.Context, serves ...func() error) error {
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.shutdownOnCancel()
+		case <-stopped:
+		}
+	}()
+	l.ready.Store(true)
+	errs := make(chan error, len(serves))
+	for _, serve := range serves {
+		go func(serve func() error) {
+			errs <- serve()
+		}(serve)
+	}
+	var err error
+	for range serves {
+		serr := <-errs
+		if serr == nil || errors.Is(serr, http.ErrServerClosed) || err != nil {
+			continue
+		}
+		err = serr
+		go l.shutdownOnCancel()
+	}
+	l.ready.Store(false)
+	<-l.shutdownDone
+	return err
+}
+
+func (l *Lux) shutdownOnCancel() {
+	shutdownCtx := ctx.Background()
+	if l.shutdownTimeout > 0 {
+		var cancel ctx.CancelFunc
+		shutdownCtx, cancel = ctx.WithTimeout(shutdownCtx, l.shutdownTimeout)
+		defer cancel()
+	}
+	if err := l.Shutdown(shutdownCtx); err != nil {
+		l.logger.Error().Str("error", err.Error()).Msg("Shutdown error")
+	}
+}
+
+func (l *Lux) Shutdown(ctx ctx.Context) error {
+	var err error
+	l.shutdownOnce.Do(func() {
+		defer close(l.shutdownDone)
+		l.draining.Store(true)
+		l.logger.Info().Dur("delay", l.shutdownDelay).Msg("Server is draining")
+		if l.shutdownDelay > 0 {
+			select {
+			case <-time.After(l.shutdownDelay):
+			case <-ctx.Done():
+			}
+		}
+		err = l.server.Shutdown(ctx)
+		for _, shutdown := range l.takeShutdownHooks() {
+			if serr := shutdown(ctx); serr != nil && err == nil {
+				err = serr
+			}
+		}
+		if l.tracer != nil {
+			if terr := l.tracer.Shutdown(ctx); terr != nil && err == nil {
+				err = terr
+			}
+		}
+		l.logger.Info().Msg("Server is shut down")
+	})
+	<-l.shutdownDone
+	return err
+}
+
+// addShutdownHook registers a listener, such as the ACME challenge server, that shuts down with the main one.
+func (l *Lux) addShutdownHook(shutdown func(ctx.Context) error) {
+	l.shutdownMu.Lock()
+	l.onShutdown = append(l.onShutdown, shutdown)
+	l.shutdownMu.Unlock()
+}
+
+func (l *Lux) takeShutdownHooks() []func(ctx.Context) error {
+	l.shutdownMu.Lock()
+	defer l.shutdownMu.Unlock()
+	hooks := l.onShutdown
+	l.onShutdown = nil
+	return hooks
+}
+
 func (l *Lux) ListenAndServe1(ctx ctx.Context, addr string) error {
 	l.buildServer(ctx, addr)
-	if err := l.server.ListenAndServe(); err != nil {
+	if err := l.serve(ctx, addr, l.server.Serve); err != nil {
 		l.logger.Fatal().Str("error", err.Error()).Msg("Listen and serve error")
 		return err
 	}
@@ -161,32 +415,44 @@ func (l *Lux) ListenAndServe1(ctx ctx.Context, addr string) error {
 
 func (l *Lux) ListenAndServe1TLS(ctx ctx.Context, addr string, certFile string, keyFile string) error {
 	l.buildServer(ctx, addr)
-	if err := l.server.ListenAndServeTLS(certFile, keyFile); err != nil {
+	if err := l.serve(ctx, addr, func(ln net.Listener) error {
+		return l.server.ServeTLS(ln, certFile, keyFile)
+	}); err != nil {
 		l.logger.Fatal().Str("error", err.Error()).Msg("Listen and serve TLS error")
 		return err
 	}
 	return nil
 }
 
-func (l *Lux) ListenAndServe1AutoTLS(ctx ctx.Context, addr []string) error {
-	if len(addr) == 0 {
-		addr = []string{"localhost:443"}
+// configureHTTP2 enables HTTP/2 on the server. h2c connections share the http2.Server,
+// so Shutdown sends them GOAWAY too.
+func (l *Lux) configureHTTP2() error {
+	if l.http2 == nil {
+		l.http2 = new(http2.Server)
 	}
-	l.buildServer(ctx, addr[0])
-	if err := certmagic.HTTPS(addr, l.builtRouter); err != nil {
-		l.logger.Fatal().Str("error", err.Error()).Msg("Listen and serve Auto TLS error")
-		return err
-	}
-	return nil
+	return http2.ConfigureServer(l.server, l.http2)
 }
 
+// h2cHandler serves h2c on top of next. h2c connections are hijacked, so http.Server.Shutdown
+// does not wait for them; their requests are counted and drained by a shutdown hook instead.
+func (l *Lux) h2cHandler(next http.Handler) http.Handler {
+	requests := new(inflight)
+	l.addShutdownHook(func(ctx ctx.Context) error {
+		requests.wait(ctx)
+		return nil
+	})
+	return h2c.NewHandler(requests.track(next), l.http2)
+}
+
+// ListenAndServe2 serves HTTP/2 without TLS (h2c), with prior knowledge or an Upgrade from HTTP/1.1.
 func (l *Lux) ListenAndServe2(ctx ctx.Context, addr string) error {
 	l.buildServer(ctx, addr)
-	if err := http2.ConfigureServer(l.server, nil); err != nil {
+	if err := l.configureHTTP2(); err != nil {
 		l.logger.Fatal().Str("error", err.Error()).Msg("Http2 configuration error")
 		return err
 	}
-	if err := l.server.ListenAndServe(); err != nil {
+	l.server.Handler = l.h2cHandler(l)
+	if err := l.serve(ctx, addr, l.server.Serve); err != nil {
 		l.logger.Fatal().Str("error", err.Error()).Msg("Listen and serve http2 error")
 		return err
 	}
@@ -195,29 +461,15 @@ func (l *Lux) ListenAndServe2(ctx ctx.Context, addr string) error {
 
 func (l *Lux) ListenAndServe2TLS(ctx ctx.Context, addr string, certFile string, keyFile string) error {
 	l.buildServer(ctx, addr)
-	if err := http2.ConfigureServer(l.server, nil); err != nil {
+	if err := l.configureHTTP2(); err != nil {
 		l.logger.Fatal().Str("error", err.Error()).Msg("Http2 configuration error")
 		return err
 	}
-	if err := l.server.ListenAndServeTLS(certFile, keyFile); err != nil {
+	if err := l.serve(ctx, addr, func(ln net.Listener) error {
+		return l.server.ServeTLS(ln, certFile, keyFile)
+	}); err != nil {
 		l.logger.Fatal().Str("error", err.Error()).Msg("Listen and serve http2 TLS error")
 		return err
 	}
 	return nil
 }
-
-func (l *Lux) ListenAndServe2AutoTLS(ctx ctx.Context, addr []string) error {
-	if len(addr) == 0 {
-		addr = []string{"localhost:443"}
-	}
-	l.buildServer(ctx, addr[0])
-	if err := http2.ConfigureServer(l.server, nil); err != nil {
-		l.logger.Fatal().Str("error", err.Error()).Msg("Http2 configuration error")
-		return err
-	}
-	if err := certmagic.HTTPS(addr, l.builtRouter); err != nil {
-		l.logger.Fatal().Str("error", err.Error()).Msg("Listen and serve http2 Auto TLS error")
-		return err
-	}
-	return nil
-}
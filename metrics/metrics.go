@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/snowmerak/lux/context"
+)
+
+var DefaultSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+
+type Metrics struct {
+	enabled atomic.Bool
+
+	registry      *Registry
+	requests      *CounterVec
+	duration      *HistogramVec
+	responseSize  *HistogramVec
+	inFlight      *Gauge
+	wsConnections *Gauge
+}
+
+func New() *Metrics {
+	registry := NewRegistry()
+	return &Metrics{
+		registry:      registry,
+		requests:      registry.NewCounterVec("lux_http_requests_total", "Total number of HTTP requests.", "route", "method", "status"),
+		duration:      registry.NewHistogramVec("lux_http_request_duration_seconds", "HTTP request latency in seconds.", DefaultBuckets, "route", "method", "status"),
+		responseSize:  registry.NewHistogramVec("lux_http_response_size_bytes", "HTTP response size in bytes.", DefaultSizeBuckets, "route", "method", "status"),
+		inFlight:      registry.NewGaugeVec("lux_http_requests_in_flight", "Number of HTTP requests being served.").With(),
+		wsConnections: registry.NewGaugeVec("lux_websocket_connections", "Number of open WebSocket connections.").With(),
+	}
+}
+
+func (m *Metrics) Enable() {
+	m.enabled.Store(true)
+}
+
+func (m *Metrics) Enabled() bool {
+	return m != nil && m.enabled.Load()
+}
+
+func (m *Metrics) Registry() *Registry {
+	return m.registry
+}
+
+type Record struct {
+	metrics *Metrics
+	lc      *context.LuxContext
+	start   time.Time
+}
+
+func (m *Metrics) Begin(lc *context.LuxContext) *Record {
+	m.inFlight.Inc()
+	return &Record{
+		metrics: m,
+		lc:      lc,
+		start:   time.Now(),
+	}
+}
+
+func (r *Record) End() {
+	m := r.metrics
+	m.inFlight.Dec()
+	route := r.lc.RoutePattern
+	method := r.lc.Request.Method
+	status := strconv.Itoa(r.lc.Response.StatusCode)
+	m.requests.With(route, method, status).Inc()
+	m.duration.With(route, method, status).Observe(time.Since(r.start).Seconds())
+	m.responseSize.With(route, method, status).Observe(float64(len(r.lc.Response.Body)))
+}
+
+func (m *Metrics) WebsocketOpened() {
+	if !m.Enabled() {
+		return
+	}
+	m.wsConnections.Inc()
+}
+
+func (m *Metrics) WebsocketClosed() {
+	if !m.Enabled() {
+		return
+	}
+	m.wsConnections.Dec()
+}
@@ -0,0 +1,341 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+type Registry struct {
+	lock       sync.RWMutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range r.collectors {
+		c.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type family[T any] struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+	lock   sync.RWMutex
+	series map[string]*T
+	values map[string][]string
+	create func() *T
+}
+
+func newFamily[T any](name, help, kind string, labels []string, create func() *T) *family[T] {
+	return &family[T]{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]*T),
+		values: make(map[string][]string),
+		create: create,
+	}
+}
+
+func (f *family[T]) with(values ...string) *T {
+	if len(values) != len(f.labels) {
+		panic("metrics: " + f.name + " expects " + strconv.Itoa(len(f.labels)) + " label values")
+	}
+	key := strings.Join(values, "\xff")
+	f.lock.RLock()
+	s, ok := f.series[key]
+	f.lock.RUnlock()
+	if ok {
+		return s
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if s, ok := f.series[key]; ok {
+		return s
+	}
+	s = f.create()
+	f.series[key] = s
+	f.values[key] = append([]string(nil), values...)
+	return s
+}
+
+func (f *family[T]) delete(values ...string) {
+	key := strings.Join(values, "\xff")
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.series, key)
+	delete(f.values, key)
+}
+
+func (f *family[T]) each(w *bufio.Writer, fn func(labels string, s *T)) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	w.WriteString("# HELP " + f.name + " " + escapeHelp(f.help) + "\n")
+	w.WriteString("# TYPE " + f.name + " " + f.kind + "\n")
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fn(formatLabels(f.labels, f.values[key]), f.series[key])
+	}
+}
+
+type value struct {
+	bits uint64
+}
+
+func (v *value) add(delta float64) {
+	for {
+		old := atomic.LoadUint64(&v.bits)
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if atomic.CompareAndSwapUint64(&v.bits, old, next) {
+			return
+		}
+	}
+}
+
+func (v *value) set(f float64) {
+	atomic.StoreUint64(&v.bits, math.Float64bits(f))
+}
+
+func (v *value) get() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.bits))
+}
+
+type Counter struct {
+	v value
+}
+
+func (c *Counter) Inc() {
+	c.v.add(1)
+}
+
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		return
+	}
+	c.v.add(delta)
+}
+
+type CounterVec struct {
+	f *family[Counter]
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{f: newFamily(name, help, "counter", labels, func() *Counter { return new(Counter) })}
+	r.register(c)
+	return c
+}
+
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.f.with(values...)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.f.each(w, func(labels string, s *Counter) {
+		writeSample(w, c.f.name, labels, s.v.get())
+	})
+}
+
+type Gauge struct {
+	v value
+}
+
+func (g *Gauge) Set(f float64) {
+	g.v.set(f)
+}
+
+func (g *Gauge) Add(delta float64) {
+	g.v.add(delta)
+}
+
+func (g *Gauge) Inc() {
+	g.v.add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.v.add(-1)
+}
+
+type GaugeVec struct {
+	f *family[Gauge]
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{f: newFamily(name, help, "gauge", labels, func() *Gauge { return new(Gauge) })}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeVec) With(values ...string) *Gauge {
+	return g.f.with(values...)
+}
+
+// Delete removes the series with the given label values, e.g. for a resource that is gone.
+func (g *GaugeVec) Delete(values ...string) {
+	g.f.delete(values...)
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	g.f.each(w, func(labels string, s *Gauge) {
+		writeSample(w, g.f.name, labels, s.v.get())
+	})
+}
+
+type Histogram struct {
+	upper  []float64
+	counts []uint64
+	count  uint64
+	sum    value
+}
+
+func (h *Histogram) Observe(f float64) {
+	i := sort.SearchFloat64s(h.upper, f)
+	if i < len(h.counts) {
+		atomic.AddUint64(&h.counts[i], 1)
+	}
+	h.sum.add(f)
+	atomic.AddUint64(&h.count, 1)
+}
+
+type HistogramVec struct {
+	f *family[Histogram]
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	upper := append([]float64(nil), buckets...)
+	sort.Float64s(upper)
+	h := &HistogramVec{f: newFamily(name, help, "histogram", labels, func() *Histogram {
+		return &Histogram{
+			upper:  upper,
+			counts: make([]uint64, len(upper)),
+		}
+	})}
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.f.with(values...)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.f.each(w, func(labels string, s *Histogram) {
+		cumulative := uint64(0)
+		for i, upper := range s.upper {
+			cumulative += atomic.LoadUint64(&s.counts[i])
+			writeSample(w, h.f.name+"_bucket", appendLabel(labels, "le", formatFloat(upper)), float64(cumulative))
+		}
+		count := atomic.LoadUint64(&s.count)
+		writeSample(w, h.f.name+"_bucket", appendLabel(labels, "le", "+Inf"), float64(count))
+		writeSample(w, h.f.name+"_sum", labels, s.sum.get())
+		writeSample(w, h.f.name+"_count", labels, float64(count))
+	})
+}
+
+func writeSample(w *bufio.Writer, name, labels string, v float64) {
+	w.WriteString(name)
+	w.WriteString(labels)
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	sb := strings.Builder{}
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name)
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabel(values[i]))
+		sb.WriteByte('"')
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func appendLabel(labels, name, value string) string {
+	pair := name + `="` + escapeLabel(value) + `"`
+	if labels == "" {
+		return "{" + pair + "}"
+	}
+	return labels[:len(labels)-1] + "," + pair + "}"
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+var helpReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -4,14 +4,14 @@ import (
 	"github.com/snowmerak/lux/context"
 	"net/http"
 
+	"github.com/snowmerak/lux/acl"
 	"github.com/snowmerak/lux/util"
 )
 
 func AllowStaticIPs(ips ...string) Set {
 	return Set{
 		Request: func(ctx *context.LuxContext) (*context.LuxContext, int) {
-			req := ctx.Request
-			remoteIP := util.GetIP(req.RemoteAddr)
+			remoteIP := ctx.GetRemoteIP()
 			for _, ip := range ips {
 				if remoteIP == ip {
 					return ctx, http.StatusOK
@@ -26,8 +26,7 @@ func AllowStaticIPs(ips ...string) Set {
 func BlockStaticIPs(ips ...string) Set {
 	return Set{
 		Request: func(ctx *context.LuxContext) (*context.LuxContext, int) {
-			req := ctx.Request
-			remoteIP := util.GetIP(req.RemoteAddr)
+			remoteIP := ctx.GetRemoteIP()
 			for _, ip := range ips {
 				if remoteIP == ip {
 					return ctx, http.StatusForbidden
@@ -42,8 +41,7 @@ func BlockStaticIPs(ips ...string) Set {
 func AllowDynamicIPs(checker func(remoteIP string) bool) Set {
 	return Set{
 		Request: func(ctx *context.LuxContext) (*context.LuxContext, int) {
-			req := ctx.Request
-			remoteIP := util.GetIP(req.RemoteAddr)
+			remoteIP := ctx.GetRemoteIP()
 			if checker(remoteIP) {
 				return ctx, http.StatusOK
 			}
@@ -56,8 +54,7 @@ func AllowDynamicIPs(checker func(remoteIP string) bool) Set {
 func BlockDynamicIPs(checker func(remoteIP string) bool) Set {
 	return Set{
 		Request: func(ctx *context.LuxContext) (*context.LuxContext, int) {
-			req := ctx.Request
-			remoteIP := util.GetIP(req.RemoteAddr)
+			remoteIP := ctx.GetRemoteIP()
 			if checker(remoteIP) {
 				return ctx, http.StatusForbidden
 			}
@@ -126,3 +123,24 @@ func BlockDynamicPorts(checker func(remotePort string) bool) Set {
 		Response: nil,
 	}
 }
+
+func ACL(engine *acl.Engine) Set {
+	return Set{
+		Request: func(ctx *context.LuxContext) (*context.LuxContext, int) {
+			remoteIP := ctx.GetRemoteIP()
+			decision := engine.Decide(remoteIP)
+			if ctx.Logger != nil {
+				event := ctx.Logger.Debug()
+				if !decision.Allowed {
+					event = ctx.Logger.Info()
+				}
+				event.Str("ip", remoteIP).Str("path", ctx.Request.URL.Path).Bool("allowed", decision.Allowed).Str("rule", decision.Rule.String()).Msg("ACL decision")
+			}
+			if decision.Allowed {
+				return ctx, http.StatusOK
+			}
+			return ctx, http.StatusForbidden
+		},
+		Response: nil,
+	}
+}
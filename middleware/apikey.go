@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/store/keyvalue"
+	"github.com/snowmerak/lux/swagger"
+)
+
+const (
+	DefaultAPIKeyName   = "X-API-Key"
+	DefaultAPIKeyPrefix = "lux:apikey:"
+)
+
+type APIKeyOptions struct {
+	// In is where the key is read from: "header", "query" or "cookie". Empty means "header".
+	In string
+	// Name is the header, query parameter or cookie holding the key. Empty means DefaultAPIKeyName.
+	Name string
+	// SecurityName names the scheme in swagger SecurityDefinitions. Empty means "api_key".
+	SecurityName string
+	// Store maps Prefix + HashAPIKey(key) to the principal owning the key, as string or []byte.
+	Store  keyvalue.KeyValue
+	Prefix string
+	// Lookup replaces Store. It gets the hashed key and returns the principal owning it, ok false for unknown keys,
+	// or an error when the backend fails, which answers 500 instead of 401.
+	Lookup func(l *context.LuxContext, hash string) (principal string, ok bool, err error)
+}
+
+// HashAPIKey is the form API keys are stored and looked up in, so a leaked store does not leak usable keys.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKey authenticates requests by API key and sets LuxContext.Principal. Unknown or missing keys get 401,
+// and lookup errors other than keyvalue.ErrNotFound get 500.
+func APIKey(opts APIKeyOptions) Set {
+	if opts.In == "" {
+		opts.In = "header"
+	}
+	if opts.Name == "" {
+		opts.Name = DefaultAPIKeyName
+	}
+	if opts.SecurityName == "" {
+		opts.SecurityName = "api_key"
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = DefaultAPIKeyPrefix
+	}
+	lookup := opts.Lookup
+	if lookup == nil {
+		lookup = func(l *context.LuxContext, hash string) (string, bool, error) {
+			if opts.Store == nil {
+				return "", false, nil
+			}
+			value, err := opts.Store.Get(opts.Prefix + hash)
+			if errors.Is(err, keyvalue.ErrNotFound) {
+				return "", false, nil
+			}
+			if err != nil {
+				return "", false, err
+			}
+			switch v := value.(type) {
+			case string:
+				return v, true, nil
+			case []byte:
+				return string(v), true, nil
+			}
+			return "", false, nil
+		}
+	}
+
+	return Set{
+		Request: func(l *context.LuxContext) (*context.LuxContext, int) {
+			key := ""
+			switch opts.In {
+			case "query":
+				key = l.GetURLQuery(opts.Name)
+			case "cookie":
+				if ck, err := l.GetCookie(opts.Name); err == nil {
+					key = ck.Value
+				}
+			default:
+				key = l.Request.Header.Get(opts.Name)
+			}
+			if key == "" {
+				return l, http.StatusUnauthorized
+			}
+			principal, ok, err := lookup(l, HashAPIKey(key))
+			if err != nil {
+				if l.Logger != nil {
+					l.Logger.Error().Str("path", l.Request.URL.Path).Err(err).Msg("API key lookup failed")
+				}
+				return l, http.StatusInternalServerError
+			}
+			if !ok {
+				return l, http.StatusUnauthorized
+			}
+			l.Principal = principal
+			return l, http.StatusOK
+		},
+		Response: nil,
+		Describe: describeSecurity(opts.SecurityName, swagger.SecurityDefinition{
+			Type: "apiKey",
+			In:   opts.In,
+			Name: opts.Name,
+		}),
+	}
+}
+
+func describeSecurity(name string, definition swagger.SecurityDefinition) func(*swagger.Swagger, *swagger.Router) {
+	return func(s *swagger.Swagger, r *swagger.Router) {
+		if s.SecurityDefinitions == nil {
+			s.SecurityDefinitions = map[string]swagger.SecurityDefinition{}
+		}
+		s.SecurityDefinitions[name] = definition
+		for _, requirement := range r.Security {
+			if _, ok := requirement[name]; ok {
+				return
+			}
+		}
+		r.Security = append(r.Security, map[string][]string{name: {}})
+	}
+}
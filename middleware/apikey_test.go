@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/store/keyvalue"
+)
+
+// apiKeyStore holds one key, or fails every call when err is set.
+type apiKeyStore struct {
+	hash, principal string
+	err             error
+}
+
+func (s *apiKeyStore) Set(key string, value any) error { return nil }
+func (s *apiKeyStore) Delete(key string) error         { return nil }
+func (s *apiKeyStore) Clear() error                    { return nil }
+
+func (s *apiKeyStore) Get(key string) (any, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if key != DefaultAPIKeyPrefix+s.hash {
+		return nil, keyvalue.ErrNotFound
+	}
+	return s.principal, nil
+}
+
+func TestAPIKeyStatus(t *testing.T) {
+	store := &apiKeyStore{hash: HashAPIKey("secret"), principal: "billing"}
+	set := APIKey(APIKeyOptions{Store: store})
+	for _, tc := range []struct {
+		name, key string
+		err       error
+		status    int
+	}{
+		{name: "known key", key: "secret", status: http.StatusOK},
+		{name: "unknown key", key: "guess", status: http.StatusUnauthorized},
+		{name: "missing key", status: http.StatusUnauthorized},
+		{name: "store outage", key: "secret", err: errors.New("connection refused"), status: http.StatusInternalServerError},
+	} {
+		store.err = tc.err
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.key != "" {
+			r.Header.Set(DefaultAPIKeyName, tc.key)
+		}
+		l := &context.LuxContext{Request: r, Response: context.NewResponse()}
+		if _, status := set.Request(l); status != tc.status {
+			t.Errorf("%s: status = %d, want %d", tc.name, status, tc.status)
+		}
+		want := ""
+		if tc.status == http.StatusOK {
+			want = "billing"
+		}
+		if l.Principal != want {
+			t.Errorf("%s: principal = %q, want %q", tc.name, l.Principal, want)
+		}
+	}
+}
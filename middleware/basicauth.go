@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+
+	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/swagger"
+)
+
+type BasicAuthOptions struct {
+	// Realm is reported in the WWW-Authenticate challenge.
+	Realm string
+	// Users maps user names to passwords.
+	Users map[string]string
+	// Validate replaces Users, for example to check a password hash.
+	Validate func(l *context.LuxContext, user, password string) bool
+	// SecurityName names the scheme in swagger SecurityDefinitions. Empty means "basic_auth".
+	SecurityName string
+}
+
+// BasicAuth authenticates requests with HTTP Basic credentials and sets LuxContext.Principal to the user name.
+func BasicAuth(opts BasicAuthOptions) Set {
+	if opts.SecurityName == "" {
+		opts.SecurityName = "basic_auth"
+	}
+	validate := opts.Validate
+	if validate == nil {
+		users := make(map[[sha256.Size]byte][sha256.Size]byte, len(opts.Users))
+		for user, password := range opts.Users {
+			users[sha256.Sum256([]byte(user))] = sha256.Sum256([]byte(password))
+		}
+		validate = func(l *context.LuxContext, user, password string) bool {
+			// Hashing first gives equal lengths to compare, and an unknown user costs the same as a wrong password.
+			want, known := users[sha256.Sum256([]byte(user))]
+			got := sha256.Sum256([]byte(password))
+			return subtle.ConstantTimeCompare(want[:], got[:]) == 1 && known
+		}
+	}
+	challenge := "Basic charset=\"UTF-8\""
+	if opts.Realm != "" {
+		challenge = "Basic realm=" + strconv.Quote(opts.Realm) + ", charset=\"UTF-8\""
+	}
+
+	return Set{
+		Request: func(l *context.LuxContext) (*context.LuxContext, int) {
+			user, password, ok := l.Request.BasicAuth()
+			if !ok || !validate(l, user, password) {
+				l.Response.Headers.Set("WWW-Authenticate", challenge)
+				return l, http.StatusUnauthorized
+			}
+			l.Principal = user
+			return l, http.StatusOK
+		},
+		Response: nil,
+		Describe: describeSecurity(opts.SecurityName, swagger.SecurityDefinition{
+			Type: "basic",
+		}),
+	}
+}
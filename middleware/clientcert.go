@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/snowmerak/lux/context"
+)
+
+// ClientCertOptions lists the certificates allowed through. Values are path.Match patterns,
+// such as "spiffe://example.org/billing/*". A certificate matching any of them is allowed,
+// and with no patterns and no Check every verified certificate is.
+type ClientCertOptions struct {
+	CommonNames   []string
+	DNSNames      []string
+	SPIFFEIDs     []string
+	Organizations []string
+	// Check replaces the pattern lists.
+	Check func(*context.CertIdentity) bool
+}
+
+// ClientCert authorises by verified client certificate and sets LuxContext.Principal to its SPIFFE ID,
+// or its common name. Requests without one get 401, certificates that do not match get 403.
+func ClientCert(opts ClientCertOptions) Set {
+	check := opts.Check
+	if check == nil {
+		check = func(id *context.CertIdentity) bool {
+			if len(opts.CommonNames)+len(opts.DNSNames)+len(opts.SPIFFEIDs)+len(opts.Organizations) == 0 {
+				return true
+			}
+			return matchAny(opts.CommonNames, id.CommonName) ||
+				matchAny(opts.SPIFFEIDs, id.SPIFFEID) ||
+				matchAny(opts.DNSNames, id.DNSNames...) ||
+				matchAny(opts.Organizations, id.Organizations...)
+		}
+	}
+	return Set{
+		Request: func(l *context.LuxContext) (*context.LuxContext, int) {
+			if l.ClientCert == nil {
+				return l, http.StatusUnauthorized
+			}
+			if !check(l.ClientCert) {
+				return l, http.StatusForbidden
+			}
+			l.Principal = l.ClientCert.SPIFFEID
+			if l.Principal == "" {
+				l.Principal = l.ClientCert.CommonName
+			}
+			return l, http.StatusOK
+		},
+		Response: nil,
+	}
+}
+
+func matchAny(patterns []string, values ...string) bool {
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, value); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
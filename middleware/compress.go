@@ -2,82 +2,331 @@ package middleware
 
 import (
 	"bytes"
-	"compress/gzip"
+	"io"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/andybalholm/brotli"
 	"github.com/golang/snappy"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
 	"github.com/snowmerak/lux/context"
 )
 
-var Snappy = Set{
-	Request: nil,
-	Response: func(l *context.LuxContext) (*context.LuxContext, error) {
-		acceptEncodings := strings.Split(l.Request.Header.Get("Accept-Encoding"), ", ")
-		if len(acceptEncodings) > 0 && acceptEncodings[0] != "snappy" || len(acceptEncodings) == 0 {
+const (
+	EncodingBrotli  = "br"
+	EncodingZstd    = "zstd"
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+	EncodingSnappy  = "snappy"
+)
+
+const DefaultCompressMinSize = 1024
+
+var DefaultCompressEncodings = []string{EncodingBrotli, EncodingZstd, EncodingGzip, EncodingDeflate, EncodingSnappy}
+
+// DefaultSkipContentTypes are media types that are already compressed.
+// An entry ending in "/" matches the whole type.
+var DefaultSkipContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"font/woff2",
+	"application/font-woff",
+	"application/font-woff2",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/x-bzip2",
+	"application/zstd",
+	"application/pdf",
+}
+
+var compressibleImages = map[string]struct{}{
+	"image/svg+xml": {},
+	"image/x-icon":  {},
+	"image/bmp":     {},
+}
+
+type CompressOptions struct {
+	// Encodings lists the supported encodings in server preference order, used to break q-value ties.
+	Encodings []string
+	// Levels sets the compression level per encoding. Missing encodings use their library default.
+	Levels map[string]int
+	// MinSize is the smallest body that is compressed. Zero means DefaultCompressMinSize, a negative value compresses every body.
+	MinSize int
+	// SkipContentTypes replaces DefaultSkipContentTypes when it is not nil.
+	SkipContentTypes []string
+	// WeakETag weakens strong ETags of compressed responses instead of tagging them with the encoding.
+	WeakETag bool
+}
+
+func Compress(opts CompressOptions) Set {
+	if opts.Encodings == nil {
+		opts.Encodings = DefaultCompressEncodings
+	}
+	if opts.MinSize == 0 {
+		opts.MinSize = DefaultCompressMinSize
+	}
+	if opts.SkipContentTypes == nil {
+		opts.SkipContentTypes = DefaultSkipContentTypes
+	}
+
+	pools := map[string]*encoderPool{}
+	supported := []string(nil)
+	for _, name := range opts.Encodings {
+		level, ok := opts.Levels[name]
+		pool := newEncoderPool(name, level, ok)
+		if pool == nil {
+			continue
+		}
+		pools[name] = pool
+		supported = append(supported, name)
+	}
+
+	return Set{
+		Request: nil,
+		Response: func(l *context.LuxContext) (*context.LuxContext, error) {
+			header := l.Response.Headers
+			if !compressible(l.Response, opts) {
+				return l, nil
+			}
+			addVary(header, "Accept-Encoding")
+
+			encoding := NegotiateEncoding(l.Request.Header.Values("Accept-Encoding"), supported)
+			if encoding == "" {
+				return l, nil
+			}
+
+			compressed, err := pools[encoding].encode(l.Response.Body)
+			if err != nil {
+				l.Response.StatusCode = http.StatusInternalServerError
+				return l, err
+			}
+			if len(compressed) >= len(l.Response.Body) {
+				return l, nil
+			}
+
+			l.Response.Body = compressed
+			header.Set("Content-Encoding", encoding)
+			header.Del("Content-Length")
+			if etag := header.Get("ETag"); etag != "" {
+				header.Set("ETag", encodedETag(etag, encoding, opts.WeakETag))
+			}
 			return l, nil
+		},
+	}
+}
+
+func compressible(r *context.Response, opts CompressOptions) bool {
+	if r.StatusCode < 200 || r.StatusCode == http.StatusNoContent || r.StatusCode == http.StatusNotModified {
+		return false
+	}
+	// Byte ranges refer to the identity body, so compressing a range would corrupt it.
+	if r.StatusCode == http.StatusPartialContent || r.Headers.Get("Content-Range") != "" {
+		return false
+	}
+	if len(r.Body) < opts.MinSize {
+		return false
+	}
+	if r.Headers.Get("Content-Encoding") != "" {
+		return false
+	}
+	if strings.Contains(strings.ToLower(r.Headers.Get("Cache-Control")), "no-transform") {
+		return false
+	}
+	contentType := strings.ToLower(r.Headers.Get("Content-Type"))
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	contentType = strings.TrimSpace(contentType)
+	if _, ok := compressibleImages[contentType]; ok {
+		return true
+	}
+	for _, skip := range opts.SkipContentTypes {
+		if strings.HasSuffix(skip, "/") && strings.HasPrefix(contentType, skip) || contentType == skip {
+			return false
 		}
-		buf := bytes.NewBuffer(nil)
-		writer := snappy.NewBufferedWriter(buf)
-		_, err := writer.Write(l.Response.Body)
-		if err != nil {
-			return l, err
-		}
-		writer.Flush()
-		writer.Close()
-		l.Response.Body = buf.Bytes()
-		l.Response.Headers.Add("Content-Encoding", "snappy")
-		l.Request.Header.Set("Accept-Encoding", strings.Join(acceptEncodings[1:], ", "))
-		return l, nil
-	},
+	}
+	return true
 }
 
-var Gzip = Set{
-	Request: nil,
-	Response: func(l *context.LuxContext) (*context.LuxContext, error) {
-		acceptEncodings := strings.Split(l.Request.Header.Get("Accept-Encoding"), ", ")
-		if len(acceptEncodings) > 0 && acceptEncodings[0] != "gzip" || len(acceptEncodings) == 0 {
-			return l, nil
+func addVary(header http.Header, value string) {
+	for _, v := range header.Values("Vary") {
+		for _, token := range strings.Split(v, ",") {
+			token = strings.TrimSpace(token)
+			if token == "*" || strings.EqualFold(token, value) {
+				return
+			}
 		}
-		buf := bytes.NewBuffer(nil)
-		writer := gzip.NewWriter(buf)
-		_, err := writer.Write(l.Response.Body)
-		if err != nil {
-			l.Response.StatusCode = http.StatusInternalServerError
-			return l, err
-		}
-		writer.Flush()
-		writer.Close()
-		l.Response.Body = buf.Bytes()
-		l.Response.Headers.Add("Content-Encoding", "gzip")
-		if len(acceptEncodings) >= 2 && acceptEncodings[1] == "defalte" {
-			acceptEncodings = acceptEncodings[1:]
-		}
-		l.Request.Header.Set("Accept-Encoding", strings.Join(acceptEncodings[1:], ", "))
-		return l, nil
-	},
+	}
+	header.Add("Vary", value)
 }
 
-var Brotli = Set{
-	Request: nil,
-	Response: func(l *context.LuxContext) (*context.LuxContext, error) {
-		acceptEncodings := strings.Split(l.Request.Header.Get("Accept-Encoding"), ", ")
-		if len(acceptEncodings) > 0 && acceptEncodings[0] != "br" || len(acceptEncodings) == 0 {
-			return l, nil
+// encodedETag keeps validators distinct per representation: a strong ETag names exact bytes,
+// so the compressed body either gets its own strong tag or is downgraded to a weak one.
+func encodedETag(etag, encoding string, weak bool) string {
+	if strings.HasPrefix(etag, "W/") || len(etag) < 2 || !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	if weak {
+		return "W/" + etag
+	}
+	return etag[:len(etag)-1] + "-" + encoding + `"`
+}
+
+type acceptedEncoding struct {
+	name string
+	q    float64
+}
+
+// NegotiateEncoding picks the supported encoding with the highest q-value in Accept-Encoding.
+// Ties go to the earlier entry of supported. It returns "" when identity should be used.
+func NegotiateEncoding(acceptEncoding []string, supported []string) string {
+	if len(acceptEncoding) == 0 {
+		return ""
+	}
+
+	explicit := map[string]float64{}
+	wildcard := -1.0
+	for _, value := range acceptEncoding {
+		for _, part := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(part, ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			q := 1.0
+			for _, param := range strings.Split(params, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(key), "q") {
+					continue
+				}
+				parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+				if err != nil || parsed < 0 || parsed > 1 {
+					parsed = 0
+				}
+				q = parsed
+			}
+			if name == "*" {
+				wildcard = q
+				continue
+			}
+			if name == "x-gzip" {
+				name = EncodingGzip
+			}
+			explicit[name] = q
 		}
-		buf := bytes.NewBuffer(nil)
-		writer := brotli.NewWriter(buf)
-		_, err := writer.Write(l.Response.Body)
-		if err != nil {
-			l.Response.StatusCode = http.StatusInternalServerError
-			return l, err
-		}
-		writer.Flush()
-		writer.Close()
-		l.Response.Body = buf.Bytes()
-		l.Response.Headers.Add("Content-Encoding", "br")
-		l.Request.Header.Set("Accept-Encoding", strings.Join(acceptEncodings[1:], ", "))
-		return l, nil
-	},
+	}
+
+	candidates := make([]acceptedEncoding, 0, len(supported))
+	for _, name := range supported {
+		q, ok := explicit[name]
+		if !ok {
+			q = wildcard
+		}
+		if q > 0 {
+			candidates = append(candidates, acceptedEncoding{name: name, q: q})
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	return candidates[0].name
+}
+
+type resetWriteCloser interface {
+	io.WriteCloser
+	Reset(io.Writer)
+}
+
+type encoderPool struct {
+	pool sync.Pool
 }
+
+func newEncoderPool(name string, level int, hasLevel bool) *encoderPool {
+	var create func() resetWriteCloser
+	switch name {
+	case EncodingBrotli:
+		if !hasLevel {
+			level = brotli.DefaultCompression
+		}
+		create = func() resetWriteCloser {
+			return brotli.NewWriterLevel(nil, level)
+		}
+	case EncodingZstd:
+		encoderLevel := zstd.SpeedDefault
+		if hasLevel {
+			encoderLevel = zstd.EncoderLevelFromZstd(level)
+		}
+		create = func() resetWriteCloser {
+			w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(encoderLevel), zstd.WithEncoderConcurrency(1))
+			return w
+		}
+	case EncodingGzip:
+		if !hasLevel {
+			level = gzip.DefaultCompression
+		}
+		if _, err := gzip.NewWriterLevel(nil, level); err != nil {
+			level = gzip.DefaultCompression
+		}
+		create = func() resetWriteCloser {
+			w, _ := gzip.NewWriterLevel(nil, level)
+			return w
+		}
+	case EncodingDeflate:
+		if !hasLevel {
+			level = zlib.DefaultCompression
+		}
+		if _, err := zlib.NewWriterLevel(nil, level); err != nil {
+			level = zlib.DefaultCompression
+		}
+		create = func() resetWriteCloser {
+			w, _ := zlib.NewWriterLevel(nil, level)
+			return w
+		}
+	case EncodingSnappy:
+		create = func() resetWriteCloser {
+			return snappy.NewBufferedWriter(nil)
+		}
+	default:
+		return nil
+	}
+	return &encoderPool{
+		pool: sync.Pool{New: func() any { return create() }},
+	}
+}
+
+func (p *encoderPool) encode(body []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, len(body)/2))
+	w := p.pool.Get().(resetWriteCloser)
+	w.Reset(buf)
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	w.Reset(nil)
+	p.pool.Put(w)
+	return buf.Bytes(), nil
+}
+
+// Deprecated: use Compress, which negotiates q-values across every supported encoding.
+var Snappy = Compress(CompressOptions{Encodings: []string{EncodingSnappy}, MinSize: -1})
+
+// Deprecated: use Compress, which negotiates q-values across every supported encoding.
+var Gzip = Compress(CompressOptions{Encodings: []string{EncodingGzip}, MinSize: -1})
+
+// Deprecated: use Compress, which negotiates q-values across every supported encoding.
+var Brotli = Compress(CompressOptions{Encodings: []string{EncodingBrotli}, MinSize: -1})
@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zlib"
+	"github.com/klauspost/compress/zstd"
+	"github.com/snowmerak/lux/context"
+)
+
+const (
+	DefaultDecompressMaxSize  = 32 << 20
+	DefaultDecompressMaxRatio = 100
+)
+
+// decompressRatioSlack lets tiny payloads, whose ratio says nothing about a bomb, decode freely.
+const decompressRatioSlack = 64 << 10
+
+var ErrDecompressionRatio = errors.New("request body decompression ratio exceeded")
+
+type DecompressOptions struct {
+	// Encodings lists the accepted Content-Encoding values. Nil accepts every supported encoding.
+	Encodings []string
+	// MaxSize is the largest decoded body in bytes. Zero means DefaultDecompressMaxSize.
+	MaxSize int64
+	// MaxRatio is the largest decoded to encoded size ratio. Zero means DefaultDecompressMaxRatio.
+	MaxRatio float64
+}
+
+// Decompress decodes request bodies sent with Content-Encoding br, zstd, gzip, deflate or snappy.
+// Reading past MaxSize fails with *http.MaxBytesError, and exceeding MaxRatio fails with ErrDecompressionRatio.
+func Decompress(opts DecompressOptions) Set {
+	if opts.Encodings == nil {
+		opts.Encodings = DefaultCompressEncodings
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultDecompressMaxSize
+	}
+	if opts.MaxRatio <= 0 {
+		opts.MaxRatio = DefaultDecompressMaxRatio
+	}
+	accepted := map[string]struct{}{}
+	for _, encoding := range opts.Encodings {
+		accepted[encoding] = struct{}{}
+	}
+
+	return Set{
+		Request: func(l *context.LuxContext) (*context.LuxContext, int) {
+			req := l.Request
+			codings := []string(nil)
+			for _, value := range req.Header.Values("Content-Encoding") {
+				for _, coding := range strings.Split(value, ",") {
+					coding = strings.ToLower(strings.TrimSpace(coding))
+					if coding == "x-gzip" {
+						coding = EncodingGzip
+					}
+					if coding != "" && coding != "identity" {
+						codings = append(codings, coding)
+					}
+				}
+			}
+			if len(codings) == 0 || req.Body == nil || req.Body == http.NoBody {
+				return l, http.StatusOK
+			}
+
+			encoded := &countingReader{reader: req.Body}
+			body := &decodedBody{
+				closers: []io.Closer{req.Body},
+			}
+			reader := io.Reader(encoded)
+			for i := len(codings) - 1; i >= 0; i-- {
+				if _, ok := accepted[codings[i]]; !ok {
+					body.Close()
+					return l, http.StatusUnsupportedMediaType
+				}
+				decoder, closer, err := newDecoder(codings[i], reader, opts.MaxSize)
+				if err != nil {
+					body.Close()
+					return l, http.StatusBadRequest
+				}
+				if closer != nil {
+					body.closers = append(body.closers, closer)
+				}
+				reader = decoder
+			}
+			body.reader = reader
+			body.encoded = encoded
+			body.maxSize = opts.MaxSize
+			body.maxRatio = opts.MaxRatio
+
+			req.Body = body
+			req.Header.Del("Content-Encoding")
+			req.Header.Del("Content-Length")
+			req.ContentLength = -1
+			return l, http.StatusOK
+		},
+		Response: nil,
+	}
+}
+
+func newDecoder(encoding string, r io.Reader, maxSize int64) (io.Reader, io.Closer, error) {
+	switch encoding {
+	case EncodingGzip:
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr, nil
+	case EncodingDeflate:
+		zr, err := zlib.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr, nil
+	case EncodingBrotli:
+		return brotli.NewReader(r), nil, nil
+	case EncodingZstd:
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(maxSize)))
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, closerFunc(func() error {
+			zr.Close()
+			return nil
+		}), nil
+	case EncodingSnappy:
+		return snappy.NewReader(r), nil, nil
+	}
+	return nil, nil, errors.New("unsupported content encoding: " + encoding)
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type decodedBody struct {
+	reader   io.Reader
+	encoded  *countingReader
+	closers  []io.Closer
+	decoded  int64
+	maxSize  int64
+	maxRatio float64
+	err      error
+}
+
+func (d *decodedBody) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if remaining := d.maxSize - d.decoded + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := d.reader.Read(p)
+	d.decoded += int64(n)
+	if d.decoded > d.maxSize || errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		d.err = &http.MaxBytesError{Limit: d.maxSize}
+		return 0, d.err
+	}
+	if d.decoded > decompressRatioSlack && float64(d.decoded) > float64(d.encoded.n)*d.maxRatio {
+		d.err = ErrDecompressionRatio
+		return 0, d.err
+	}
+	return n, err
+}
+
+func (d *decodedBody) Close() error {
+	var err error
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		if cerr := d.closers[i].Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
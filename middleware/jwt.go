@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/snowmerak/lux/context"
+)
+
+// invalidTokenDescription is the only error_description sent for a rejected token, since parser and
+// key set errors name key ids, algorithms and fetch failures. The error itself is logged.
+const invalidTokenDescription = "the access token is invalid or expired"
+
+type JWTAuthOptions struct {
+	// Realm is reported in the WWW-Authenticate challenge.
+	Realm string
+	// Scopes must all be granted by the scope or scp claim.
+	Scopes []string
+	// Roles requires at least one of them in the roles or role claim.
+	Roles []string
+}
+
+// JWTAuth verifies the bearer access token and stores its claims in LuxContext.Claims.
+// A missing or invalid token is answered with 401 and a WWW-Authenticate challenge,
+// missing scopes or roles with 403.
+func JWTAuth(opts JWTAuthOptions) Set {
+	return Set{
+		Request: func(l *context.LuxContext) (*context.LuxContext, int) {
+			if l.JWTConfig == nil {
+				return l, http.StatusInternalServerError
+			}
+			auth := l.Request.Header.Get("Authorization")
+			if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+				l.Response.Headers.Set("WWW-Authenticate", bearerChallenge(opts.Realm, "", "", ""))
+				return l, http.StatusUnauthorized
+			}
+			claims, err := l.JWT().GetAccessToken()
+			if err != nil {
+				if l.Logger != nil {
+					l.Logger.Info().Str("path", l.Request.URL.Path).Str("remote", l.GetRemoteIP()).Err(err).Msg("Access token rejected")
+				}
+				l.Response.Headers.Set("WWW-Authenticate", bearerChallenge(opts.Realm, "invalid_token", invalidTokenDescription, ""))
+				return l, http.StatusUnauthorized
+			}
+			l.Claims = claims
+			return l, authorizeClaims(l, opts.Realm, opts.Scopes, opts.Roles)
+		},
+		Response: nil,
+	}
+}
+
+// RequireScopes answers 403 unless the claims stored by JWTAuth grant every scope.
+func RequireScopes(scopes ...string) Set {
+	return Set{
+		Request: func(l *context.LuxContext) (*context.LuxContext, int) {
+			return l, authorizeClaims(l, "", scopes, nil)
+		},
+		Response: nil,
+	}
+}
+
+// RequireRoles answers 403 unless the claims stored by JWTAuth hold at least one of the roles.
+func RequireRoles(roles ...string) Set {
+	return Set{
+		Request: func(l *context.LuxContext) (*context.LuxContext, int) {
+			return l, authorizeClaims(l, "", nil, roles)
+		},
+		Response: nil,
+	}
+}
+
+func authorizeClaims(l *context.LuxContext, realm string, scopes []string, roles []string) int {
+	if len(scopes) == 0 && len(roles) == 0 {
+		return http.StatusOK
+	}
+	if l.Claims == nil {
+		l.Response.Headers.Set("WWW-Authenticate", bearerChallenge(realm, "", "", ""))
+		return http.StatusUnauthorized
+	}
+	claims := context.MapClaims(l.Claims)
+
+	granted := map[string]struct{}{}
+	for _, scope := range context.ClaimStrings(claims["scope"], claims["scp"]) {
+		granted[scope] = struct{}{}
+	}
+	for _, scope := range scopes {
+		if _, ok := granted[scope]; !ok {
+			l.Response.Headers.Set("WWW-Authenticate", bearerChallenge(realm, "insufficient_scope", "", strings.Join(scopes, " ")))
+			return http.StatusForbidden
+		}
+	}
+
+	if len(roles) == 0 {
+		return http.StatusOK
+	}
+	for _, held := range context.ClaimStrings(claims["roles"], claims["role"]) {
+		for _, role := range roles {
+			if held == role {
+				return http.StatusOK
+			}
+		}
+	}
+	return http.StatusForbidden
+}
+
+func bearerChallenge(realm, errorCode, description, scope string) string {
+	params := []string(nil)
+	if realm != "" {
+		params = append(params, "realm="+strconv.Quote(realm))
+	}
+	if errorCode != "" {
+		params = append(params, "error="+strconv.Quote(errorCode))
+	}
+	if description != "" {
+		params = append(params, "error_description="+strconv.Quote(description))
+	}
+	if scope != "" {
+		params = append(params, "scope="+strconv.Quote(scope))
+	}
+	if len(params) == 0 {
+		return "Bearer"
+	}
+	return "Bearer " + strings.Join(params, ", ")
+}
@@ -3,13 +3,38 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
 
 	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/swagger"
+	"github.com/snowmerak/lux/trace"
 )
 
 type Set struct {
 	Request  func(*context.LuxContext) (*context.LuxContext, int)
 	Response func(*context.LuxContext) (*context.LuxContext, error)
+	// Describe documents the middleware, such as its security scheme, on every swagger route using it.
+	Describe func(*swagger.Swagger, *swagger.Router)
+}
+
+func (s Set) String() string {
+	names := []string(nil)
+	if s.Request != nil {
+		names = append(names, funcName(s.Request))
+	}
+	if s.Response != nil {
+		names = append(names, funcName(s.Response))
+	}
+	return strings.Join(names, ", ")
+}
+
+func funcName(fn any) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		return f.Name()
+	}
+	return ""
 }
 
 func ApplyRequests(ctx *context.LuxContext, middlewares []Set) string {
@@ -17,10 +42,12 @@ func ApplyRequests(ctx *context.LuxContext, middlewares []Set) string {
 		if m.Request == nil {
 			continue
 		}
+		span := startSpan(ctx, "middleware request", m.Request)
 		_, code := m.Request(ctx)
+		endSpan(ctx, span, code, nil)
 		if 400 <= code && code < 600 {
 			ctx.Response.WriteHeader(code)
-			return fmt.Sprintf("Middleware Request Reading %s: %s from %s", ctx.Request.URL.Path, http.StatusText(code), ctx.Request.RemoteAddr)
+			return fmt.Sprintf("Middleware Request Reading %s: %s from %s", ctx.Request.URL.Path, http.StatusText(code), ctx.GetRemoteIP())
 		}
 	}
 	return ""
@@ -31,10 +58,44 @@ func ApplyResponses(ctx *context.LuxContext, middlewares []Set) string {
 		if m.Response == nil {
 			continue
 		}
+		span := startSpan(ctx, "middleware response", m.Response)
 		_, err := m.Response(ctx)
+		endSpan(ctx, span, 0, err)
 		if err != nil {
-			return fmt.Sprintf("Middleware Response Writing %s: %s from %s", ctx.Request.URL.Path, err.Error(), ctx.Request.RemoteAddr)
+			return fmt.Sprintf("Middleware Response Writing %s: %s from %s", ctx.Request.URL.Path, err.Error(), ctx.GetRemoteIP())
 		}
 	}
 	return ""
 }
+
+type phaseSpan struct {
+	span   *trace.Span
+	parent *trace.Span
+}
+
+func startSpan(l *context.LuxContext, name string, fn any) phaseSpan {
+	spanCtx, span := trace.StartChild(l.RequestContext, name)
+	if span == nil {
+		return phaseSpan{}
+	}
+	span.SetAttribute("lux.middleware", funcName(fn))
+	ps := phaseSpan{span: span, parent: trace.SpanFromContext(l.RequestContext)}
+	l.RequestContext = spanCtx
+	return ps
+}
+
+func endSpan(l *context.LuxContext, ps phaseSpan, code int, err error) {
+	if ps.span == nil {
+		return
+	}
+	// Values stored by the phase stay in RequestContext; only the active span is restored.
+	l.RequestContext = trace.ContextWithSpan(l.RequestContext, ps.parent)
+	if code != 0 {
+		ps.span.SetAttribute("http.status_code", code)
+		if 400 <= code && code < 600 {
+			ps.span.SetStatus(trace.StatusError, http.StatusText(code))
+		}
+	}
+	ps.span.RecordError(err)
+	ps.span.End()
+}
@@ -0,0 +1,51 @@
+package oauth
+
+import (
+	ctx "context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const idTokenLeeway = time.Minute
+
+// VerifyIDToken checks the signature against the provider JWKS, then issuer, audience, expiry and nonce.
+func (p *Provider) VerifyIDToken(c ctx.Context, idToken string, nonce string) (jwt.MapClaims, error) {
+	if p.keys == nil {
+		return nil, errors.New("oauth: no JWKS endpoint to verify the ID token")
+	}
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(p.cfg.AllowedAlgorithms),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(idTokenLeeway),
+	}
+	if p.cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(p.cfg.Issuer))
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.Key(c, kid)
+	}, options...)
+	if err != nil {
+		return nil, fmt.Errorf("oauth: invalid ID token: %w", err)
+	}
+
+	if exp, _ := claims.GetExpirationTime(); exp == nil {
+		return nil, errors.New("oauth: invalid ID token: missing exp")
+	}
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != p.cfg.ClientID {
+			return nil, errors.New("oauth: invalid ID token: azp does not match the client id")
+		}
+	}
+	got, _ := claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+		return nil, errors.New("oauth: invalid ID token: nonce mismatch")
+	}
+	return claims, nil
+}
@@ -0,0 +1,402 @@
+package oauth
+
+import (
+	ctx "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/jwks"
+	"github.com/snowmerak/lux/middleware"
+	"github.com/snowmerak/lux/router"
+)
+
+const (
+	DefaultCookieName = "lux-oauth"
+	DefaultStateTTL   = 10 * time.Minute
+)
+
+var DefaultScopes = []string{"openid", "profile", "email"}
+
+type Config struct {
+	// Issuer enables OpenID Connect discovery from Issuer + "/.well-known/openid-configuration".
+	Issuer string
+	// The endpoints override discovered ones, and are required for plain OAuth2 providers.
+	AuthorizationURL string
+	TokenURL         string
+	JWKSURL          string
+	EndSessionURL    string
+
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the absolute URL of the callback route.
+	RedirectURL string
+	Scopes      []string
+	// CookieSecret signs the cookie holding state, nonce and PKCE verifier. It must be at least 32 bytes.
+	CookieSecret []byte
+	CookieName   string
+	StateTTL     time.Duration
+	// PostLogoutRedirectURL is where the logout route sends the browser, through the provider when it has an end session endpoint.
+	PostLogoutRedirectURL string
+	// AllowedAlgorithms pins the ID token alg. Empty means the discovered algorithms, or RS256.
+	AllowedAlgorithms []string
+	Client            *http.Client
+
+	// OnLogin runs after a successful callback, typically to issue Lux tokens with l.JWT().
+	// Unless it writes a response itself, the browser is redirected to the return_to path of the login.
+	OnLogin func(l *context.LuxContext, result *Result) error
+	// OnLogout runs before the logout redirect, typically to revoke Lux tokens.
+	OnLogout func(l *context.LuxContext) error
+}
+
+type Result struct {
+	AccessToken  string
+	RefreshToken string
+	TokenType    string
+	Expiry       time.Time
+	IDToken      string
+	// Claims are the verified ID token claims. They are nil when the provider returned no ID token.
+	Claims  jwt.MapClaims
+	Subject string
+}
+
+type Provider struct {
+	cfg  Config
+	keys *jwks.Client
+}
+
+type discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	EndSessionEndpoint    string   `json:"end_session_endpoint"`
+	SigningAlgorithms     []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// New discovers the provider when Issuer is set and checks the config.
+func New(c ctx.Context, cfg Config) (*Provider, error) {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.Scopes == nil {
+		cfg.Scopes = DefaultScopes
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = DefaultCookieName
+	}
+	if cfg.StateTTL <= 0 {
+		cfg.StateTTL = DefaultStateTTL
+	}
+	if len(cfg.CookieSecret) < 32 {
+		return nil, errors.New("oauth: CookieSecret must be at least 32 bytes")
+	}
+
+	if cfg.Issuer != "" {
+		d, err := discover(c, cfg.Client, cfg.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.AuthorizationURL == "" {
+			cfg.AuthorizationURL = d.AuthorizationEndpoint
+		}
+		if cfg.TokenURL == "" {
+			cfg.TokenURL = d.TokenEndpoint
+		}
+		if cfg.JWKSURL == "" {
+			cfg.JWKSURL = d.JWKSURI
+		}
+		if cfg.EndSessionURL == "" {
+			cfg.EndSessionURL = d.EndSessionEndpoint
+		}
+		if len(cfg.AllowedAlgorithms) == 0 {
+			for _, alg := range d.SigningAlgorithms {
+				if alg != "none" && !strings.HasPrefix(alg, "HS") {
+					cfg.AllowedAlgorithms = append(cfg.AllowedAlgorithms, alg)
+				}
+			}
+		}
+	}
+	if len(cfg.AllowedAlgorithms) == 0 {
+		cfg.AllowedAlgorithms = []string{"RS256"}
+	}
+	if cfg.AuthorizationURL == "" || cfg.TokenURL == "" {
+		return nil, errors.New("oauth: authorization and token endpoints are required")
+	}
+
+	p := &Provider{cfg: cfg}
+	if cfg.JWKSURL != "" {
+		p.keys = jwks.NewClient(jwks.ClientConfig{URL: cfg.JWKSURL, Client: cfg.Client})
+	}
+	return p, nil
+}
+
+func discover(c ctx.Context, client *http.Client, issuer string) (*discovery, error) {
+	wellKnown := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(c, http.MethodGet, wellKnown, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oauth: discovery %s: %s", wellKnown, resp.Status)
+	}
+	d := &discovery{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(d); err != nil {
+		return nil, err
+	}
+	if d.Issuer != issuer {
+		return nil, fmt.Errorf("oauth: discovered issuer %q does not match %q", d.Issuer, issuer)
+	}
+	return d, nil
+}
+
+// Mount adds GET /login, /callback and /logout to rg. RedirectURL must point at the callback route.
+func (p *Provider) Mount(rg *router.RouterGroup, middlewares ...middleware.Set) {
+	rg.GET("/login", p.Login, nil, middlewares...)
+	rg.GET("/callback", p.Callback, nil, middlewares...)
+	rg.GET("/logout", p.Logout, nil, middlewares...)
+}
+
+// Login redirects to the authorization endpoint. The return_to query is kept for the callback.
+func (p *Provider) Login(l *context.LuxContext) error {
+	s, err := newState(safeReturnTo(l.GetURLQuery("return_to")), p.cfg.StateTTL)
+	if err != nil {
+		l.SetInternalServerError()
+		return err
+	}
+	value, err := s.encode(p.cfg.CookieSecret)
+	if err != nil {
+		l.SetInternalServerError()
+		return err
+	}
+	p.setCookie(l, value, int(p.cfg.StateTTL/time.Second))
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	query.Set("state", s.State)
+	query.Set("nonce", s.Nonce)
+	query.Set("code_challenge", s.challenge())
+	query.Set("code_challenge_method", "S256")
+	redirect(l, withQuery(p.cfg.AuthorizationURL, query))
+	return nil
+}
+
+func (p *Provider) Callback(l *context.LuxContext) error {
+	cookie, err := l.GetCookie(p.cfg.CookieName)
+	if err != nil {
+		l.SetBadRequest()
+		return errors.New("oauth: missing state cookie")
+	}
+	p.setCookie(l, "", -1)
+	s, err := decodeState(cookie.Value, p.cfg.CookieSecret)
+	if err != nil {
+		l.SetBadRequest()
+		return err
+	}
+	if !s.matches(l.GetURLQuery("state")) {
+		l.SetBadRequest()
+		return errors.New("oauth: state mismatch")
+	}
+	if e := l.GetURLQuery("error"); e != "" {
+		l.SetUnauthorized()
+		return fmt.Errorf("oauth: provider error %s: %s", e, l.GetURLQuery("error_description"))
+	}
+	code := l.GetURLQuery("code")
+	if code == "" {
+		l.SetBadRequest()
+		return errors.New("oauth: missing code")
+	}
+
+	result, err := p.exchange(l.Request.Context(), code, s.Verifier)
+	if err != nil {
+		l.SetUnauthorized()
+		return err
+	}
+	if result.IDToken == "" && p.openID() {
+		l.SetUnauthorized()
+		return errors.New("oauth: token response without id_token for an openid scope")
+	}
+	if result.IDToken != "" {
+		claims, err := p.VerifyIDToken(l.Request.Context(), result.IDToken, s.Nonce)
+		if err != nil {
+			l.SetUnauthorized()
+			return err
+		}
+		result.Claims = claims
+		result.Subject, _ = claims.GetSubject()
+		p.setIDTokenCookie(l, result.IDToken, 0)
+	}
+
+	if p.cfg.OnLogin != nil {
+		if err := p.cfg.OnLogin(l, result); err != nil {
+			if l.IsOk() {
+				l.SetUnauthorized()
+			}
+			return err
+		}
+	}
+	if l.Response.Headers.Get("Location") == "" && len(l.Response.Body) == 0 {
+		redirect(l, s.ReturnTo)
+	}
+	return nil
+}
+
+func (p *Provider) Logout(l *context.LuxContext) error {
+	if p.cfg.OnLogout != nil {
+		if err := p.cfg.OnLogout(l); err != nil {
+			l.SetInternalServerError()
+			return err
+		}
+	}
+	p.setIDTokenCookie(l, "", -1)
+	target := p.cfg.PostLogoutRedirectURL
+	if target == "" {
+		target = "/"
+	}
+	if p.cfg.EndSessionURL != "" {
+		query := url.Values{}
+		query.Set("client_id", p.cfg.ClientID)
+		if cookie, err := l.GetCookie(p.idTokenCookieName()); err == nil && cookie.Value != "" {
+			query.Set("id_token_hint", cookie.Value)
+		}
+		if p.cfg.PostLogoutRedirectURL != "" {
+			query.Set("post_logout_redirect_uri", p.cfg.PostLogoutRedirectURL)
+		}
+		target = withQuery(p.cfg.EndSessionURL, query)
+	}
+	redirect(l, target)
+	return nil
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (p *Provider) exchange(c ctx.Context, code, verifier string) (*Result, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.cfg.ClientID)
+
+	req, err := http.NewRequestWithContext(c, http.MethodPost, p.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	tr := tokenResponse{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tr); err != nil {
+		return nil, fmt.Errorf("oauth: token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tr.Error != "" {
+		return nil, fmt.Errorf("oauth: token exchange failed: %s %s %s", resp.Status, tr.Error, tr.ErrorDescription)
+	}
+	if tr.AccessToken == "" {
+		return nil, errors.New("oauth: token response without access_token")
+	}
+
+	result := &Result{
+		AccessToken:  tr.AccessToken,
+		RefreshToken: tr.RefreshToken,
+		TokenType:    tr.TokenType,
+		IDToken:      tr.IDToken,
+	}
+	if tr.ExpiresIn > 0 {
+		result.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	}
+	return result, nil
+}
+
+func (p *Provider) openID() bool {
+	for _, scope := range p.cfg.Scopes {
+		if scope == "openid" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Provider) idTokenCookieName() string {
+	return p.cfg.CookieName + "-id"
+}
+
+// setIDTokenCookie keeps the ID token for the id_token_hint of RP-initiated logout.
+func (p *Provider) setIDTokenCookie(l *context.LuxContext, value string, maxAge int) {
+	p.writeCookie(l, p.idTokenCookieName(), value, maxAge)
+}
+
+func (p *Provider) setCookie(l *context.LuxContext, value string, maxAge int) {
+	p.writeCookie(l, p.cfg.CookieName, value, maxAge)
+}
+
+func (p *Provider) writeCookie(l *context.LuxContext, name, value string, maxAge int) {
+	ck := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		// Lax, because the callback is a top level navigation coming from the provider.
+		SameSite: http.SameSiteLaxMode,
+	}
+	l.Response.Headers.Add("Set-Cookie", ck.String())
+}
+
+func redirect(l *context.LuxContext, location string) {
+	l.Response.Headers.Set("Location", location)
+	l.SetFound()
+}
+
+func withQuery(base string, query url.Values) string {
+	if strings.Contains(base, "?") {
+		return base + "&" + query.Encode()
+	}
+	return base + "?" + query.Encode()
+}
+
+// safeReturnTo only keeps local paths, so the login route cannot be used as an open redirect.
+// Browsers drop tabs and newlines and read backslashes as slashes, so those are rejected outright.
+func safeReturnTo(returnTo string) string {
+	if strings.ContainsRune(returnTo, '\\') || strings.IndexFunc(returnTo, unicode.IsControl) >= 0 {
+		return "/"
+	}
+	u, err := url.Parse(returnTo)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil || !strings.HasPrefix(u.Path, "/") || strings.HasPrefix(u.Path, "//") {
+		return "/"
+	}
+	return returnTo
+}
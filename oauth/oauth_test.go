@@ -0,0 +1,389 @@
+package oauth
+
+import (
+	ctx "context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/jwks"
+)
+
+const (
+	testClientID     = "client"
+	testClientSecret = "secret"
+	testRedirectURL  = "https://app.example/auth/callback"
+)
+
+var testCookieSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// idp is an OpenID provider that issues codes bound to a PKCE challenge and a nonce.
+type idp struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	lock  sync.Mutex
+	codes map[string]grant
+	// omitIDToken makes the token endpoint answer like a plain OAuth2 provider.
+	omitIDToken bool
+}
+
+type grant struct {
+	challenge string
+	nonce     string
+}
+
+func newIDP(t *testing.T) *idp {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &idp{t: t, key: key, codes: map[string]grant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *idp) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(discovery{
+		Issuer:                p.server.URL,
+		AuthorizationEndpoint: p.server.URL + "/authorize",
+		TokenEndpoint:         p.server.URL + "/token",
+		JWKSURI:               p.server.URL + "/jwks",
+		EndSessionEndpoint:    p.server.URL + "/logout",
+		SigningAlgorithms:     []string{"RS256", "HS256", "none"},
+	})
+}
+
+func (p *idp) jwks(w http.ResponseWriter, r *http.Request) {
+	set := jwks.Set{}
+	if err := set.Add("k1", "RS256", &p.key.PublicKey); err != nil {
+		p.t.Error(err)
+	}
+	w.Header().Set("Content-Type", jwks.ContentType)
+	json.NewEncoder(w).Encode(set)
+}
+
+// authorize stands in for the browser visiting the authorization endpoint and returns the code.
+func (p *idp) authorize(location string) (code string, query url.Values) {
+	u, err := url.Parse(location)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	query = u.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		p.t.Fatalf("code_challenge_method = %q", query.Get("code_challenge_method"))
+	}
+	code, err = randomString(16)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	p.lock.Lock()
+	p.codes[code] = grant{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	p.lock.Unlock()
+	return code, query
+}
+
+func (p *idp) token(w http.ResponseWriter, r *http.Request) {
+	fail := func(reason string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(tokenResponse{Error: "invalid_grant", ErrorDescription: reason})
+	}
+	if user, pass, ok := r.BasicAuth(); !ok || user != testClientID || pass != testClientSecret {
+		fail("client authentication")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		fail(err.Error())
+		return
+	}
+	if r.PostForm.Get("redirect_uri") != testRedirectURL {
+		fail("redirect_uri")
+		return
+	}
+	p.lock.Lock()
+	g, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.lock.Unlock()
+	if !ok {
+		fail("unknown code")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		fail("code_verifier")
+		return
+	}
+
+	resp := tokenResponse{AccessToken: "access", TokenType: "Bearer", ExpiresIn: 3600}
+	if !p.omitIDToken {
+		resp.IDToken = p.sign(jwt.MapClaims{
+			"iss":   p.server.URL,
+			"sub":   "user-1",
+			"aud":   testClientID,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": g.nonce,
+		})
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (p *idp) sign(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return signed
+}
+
+func (p *idp) provider(scopes []string, onLogin func(*context.LuxContext, *Result) error) *Provider {
+	provider, err := New(ctx.Background(), Config{
+		Issuer:                p.server.URL,
+		ClientID:              testClientID,
+		ClientSecret:          testClientSecret,
+		RedirectURL:           testRedirectURL,
+		Scopes:                scopes,
+		CookieSecret:          testCookieSecret,
+		PostLogoutRedirectURL: "https://app.example/",
+		OnLogin:               onLogin,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return provider
+}
+
+func newLuxContext(target string, cookies ...*http.Cookie) *context.LuxContext {
+	r := httptest.NewRequest(http.MethodGet, target, nil)
+	for _, c := range cookies {
+		r.AddCookie(c)
+	}
+	return &context.LuxContext{Request: r, Response: context.NewResponse()}
+}
+
+func responseCookie(t *testing.T, l *context.LuxContext, name string) *http.Cookie {
+	t.Helper()
+	resp := http.Response{Header: l.Response.Headers}
+	for _, c := range resp.Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+	t.Fatalf("no %s cookie in %v", name, l.Response.Headers["Set-Cookie"])
+	return nil
+}
+
+// login runs the login route and the provider authorization, and returns the state cookie
+// with the callback query the provider would redirect to.
+func login(t *testing.T, p *idp, provider *Provider, returnTo string) (*http.Cookie, url.Values) {
+	t.Helper()
+	l := newLuxContext("/auth/login?return_to=" + url.QueryEscape(returnTo))
+	if err := provider.Login(l); err != nil {
+		t.Fatal(err)
+	}
+	if l.Response.StatusCode != http.StatusFound {
+		t.Fatalf("login status = %d", l.Response.StatusCode)
+	}
+	location := l.Response.Headers.Get("Location")
+	if !strings.HasPrefix(location, p.server.URL+"/authorize?") {
+		t.Fatalf("login redirects to %q", location)
+	}
+	code, query := p.authorize(location)
+	if query.Get("client_id") != testClientID || query.Get("redirect_uri") != testRedirectURL {
+		t.Fatalf("authorization query = %v", query)
+	}
+	callback := url.Values{}
+	callback.Set("code", code)
+	callback.Set("state", query.Get("state"))
+	return responseCookie(t, l, DefaultCookieName), callback
+}
+
+func callback(provider *Provider, query url.Values, cookies ...*http.Cookie) (*context.LuxContext, error) {
+	l := newLuxContext("/auth/callback?"+query.Encode(), cookies...)
+	return l, provider.Callback(l)
+}
+
+func TestLoginCallback(t *testing.T) {
+	p := newIDP(t)
+	var got *Result
+	provider := p.provider(nil, func(l *context.LuxContext, result *Result) error {
+		got = result
+		return nil
+	})
+
+	cookie, query := login(t, p, provider, "/dashboard?tab=1")
+	l, err := callback(provider, query, cookie)
+	if err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+	if l.Response.StatusCode != http.StatusFound || l.Response.Headers.Get("Location") != "/dashboard?tab=1" {
+		t.Fatalf("callback answered %d to %q", l.Response.StatusCode, l.Response.Headers.Get("Location"))
+	}
+	if got == nil || got.Subject != "user-1" || got.AccessToken != "access" || got.Claims == nil {
+		t.Fatalf("OnLogin result = %+v", got)
+	}
+	if state := responseCookie(t, l, DefaultCookieName); state.MaxAge >= 0 {
+		t.Errorf("state cookie is not cleared: %v", state)
+	}
+	if id := responseCookie(t, l, DefaultCookieName+"-id"); id.Value != got.IDToken || !id.HttpOnly || !id.Secure {
+		t.Errorf("ID token cookie = %v", id)
+	}
+}
+
+func TestCallbackRejectsStateMismatch(t *testing.T) {
+	p := newIDP(t)
+	provider := p.provider(nil, nil)
+
+	cookie, query := login(t, p, provider, "/")
+	query.Set("state", "forged")
+	l, err := callback(provider, query, cookie)
+	if err == nil || l.Response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("callback with a forged state = %d, %v", l.Response.StatusCode, err)
+	}
+}
+
+func TestCallbackRejectsMissingOrTamperedCookie(t *testing.T) {
+	p := newIDP(t)
+	provider := p.provider(nil, nil)
+	cookie, query := login(t, p, provider, "/")
+
+	if l, err := callback(provider, query); err == nil || l.Response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("callback without the state cookie = %d, %v", l.Response.StatusCode, err)
+	}
+	tampered := *cookie
+	tampered.Value = strings.Replace(cookie.Value, ".", ".x", 1)
+	if l, err := callback(provider, query, &tampered); err == nil || l.Response.StatusCode != http.StatusBadRequest {
+		t.Fatalf("callback with a tampered state cookie = %d, %v", l.Response.StatusCode, err)
+	}
+}
+
+func TestCallbackRejectsCodeOfAnotherLogin(t *testing.T) {
+	p := newIDP(t)
+	provider := p.provider(nil, nil)
+
+	victim, _ := login(t, p, provider, "/")
+	_, attacker := login(t, p, provider, "/")
+	// The attacker's code is bound to the attacker's PKCE challenge, not the victim's verifier.
+	victimState, err := decodeState(victim.Value, testCookieSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attacker.Set("state", victimState.State)
+	l, err := callback(provider, attacker, victim)
+	if err == nil || l.Response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("callback with another login's code = %d, %v", l.Response.StatusCode, err)
+	}
+}
+
+func TestCallbackRequiresIDTokenForOpenID(t *testing.T) {
+	p := newIDP(t)
+	p.omitIDToken = true
+	provider := p.provider(nil, nil)
+
+	cookie, query := login(t, p, provider, "/")
+	l, err := callback(provider, query, cookie)
+	if err == nil || l.Response.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("openid callback without an ID token = %d, %v", l.Response.StatusCode, err)
+	}
+}
+
+func TestCallbackWithoutOpenID(t *testing.T) {
+	p := newIDP(t)
+	p.omitIDToken = true
+	var got *Result
+	provider := p.provider([]string{"repo"}, func(l *context.LuxContext, result *Result) error {
+		got = result
+		return nil
+	})
+
+	cookie, query := login(t, p, provider, "/")
+	l, err := callback(provider, query, cookie)
+	if err != nil {
+		t.Fatalf("callback: %v", err)
+	}
+	if l.Response.StatusCode != http.StatusFound || got == nil || got.Claims != nil || got.AccessToken != "access" {
+		t.Fatalf("plain OAuth2 callback = %d, %+v", l.Response.StatusCode, got)
+	}
+}
+
+func TestLogoutSendsIDTokenHint(t *testing.T) {
+	p := newIDP(t)
+	provider := p.provider(nil, nil)
+	cookie, query := login(t, p, provider, "/")
+	l, err := callback(provider, query, cookie)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken := responseCookie(t, l, DefaultCookieName+"-id")
+
+	l = newLuxContext("/auth/logout", idToken)
+	if err := provider.Logout(l); err != nil {
+		t.Fatal(err)
+	}
+	location, err := url.Parse(l.Response.Headers.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Path != "/logout" || location.Query().Get("id_token_hint") != idToken.Value {
+		t.Fatalf("logout redirects to %v", location)
+	}
+	if location.Query().Get("post_logout_redirect_uri") != "https://app.example/" {
+		t.Errorf("post_logout_redirect_uri = %q", location.Query().Get("post_logout_redirect_uri"))
+	}
+	if cleared := responseCookie(t, l, DefaultCookieName+"-id"); cleared.MaxAge >= 0 {
+		t.Errorf("ID token cookie is not cleared: %v", cleared)
+	}
+}
+
+func TestNewIgnoresSymmetricAndNoneAlgorithms(t *testing.T) {
+	p := newIDP(t)
+	provider := p.provider(nil, nil)
+	if algs := provider.cfg.AllowedAlgorithms; len(algs) != 1 || algs[0] != "RS256" {
+		t.Fatalf("AllowedAlgorithms = %v", algs)
+	}
+}
+
+func TestSafeReturnTo(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                     "/",
+		"/":                    "/",
+		"/dashboard":           "/dashboard",
+		"/a/b?c=d#e":           "/a/b?c=d#e",
+		"dashboard":            "/",
+		"//evil.com":           "/",
+		"///evil.com":          "/",
+		"/\\evil.com":          "/",
+		"\\\\evil.com":         "/",
+		"/\t/evil.com":         "/",
+		"/\n/evil.com":         "/",
+		"/\r/evil.com":         "/",
+		"https://evil.com":     "/",
+		"https:/evil.com":      "/",
+		"javascript:alert(1)":  "/",
+		"//user@evil.com/path": "/",
+		"/%2F%2Fevil.com":      "/",
+	} {
+		if got := safeReturnTo(in); got != want {
+			t.Errorf("safeReturnTo(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package oauth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrInvalidState = errors.New("oauth: invalid state cookie")
+
+// state travels in a signed cookie between the login and the callback.
+type state struct {
+	State     string `json:"s"`
+	Nonce     string `json:"n"`
+	Verifier  string `json:"v"`
+	ReturnTo  string `json:"r"`
+	ExpiresAt int64  `json:"e"`
+}
+
+func newState(returnTo string, ttl time.Duration) (*state, error) {
+	s := &state{ReturnTo: returnTo, ExpiresAt: time.Now().Add(ttl).Unix()}
+	for _, field := range []*string{&s.State, &s.Nonce, &s.Verifier} {
+		value, err := randomString(32)
+		if err != nil {
+			return nil, err
+		}
+		*field = value
+	}
+	return s, nil
+}
+
+// challenge is the PKCE S256 code challenge of the verifier.
+func (s *state) challenge() string {
+	sum := sha256.Sum256([]byte(s.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (s *state) matches(value string) bool {
+	return value != "" && subtle.ConstantTimeCompare([]byte(s.State), []byte(value)) == 1
+}
+
+func (s *state) encode(secret []byte) (string, error) {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return payload + "." + sign(payload, secret), nil
+}
+
+func decodeState(value string, secret []byte) (*state, error) {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(sign(payload, secret))) {
+		return nil, ErrInvalidState
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidState
+	}
+	s := &state{}
+	if err := json.Unmarshal(raw, s); err != nil {
+		return nil, ErrInvalidState
+	}
+	if time.Now().Unix() > s.ExpiresAt {
+		return nil, ErrInvalidState
+	}
+	return s, nil
+}
+
+func sign(payload string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func randomString(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
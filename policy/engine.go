@@ -0,0 +1,113 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/snowmerak/lux/signal"
+)
+
+var ErrNilPolicy = errors.New("policy: nil policy")
+
+// Decider makes authorization decisions. Engine is the built-in one, and external engines can be plugged in.
+type Decider interface {
+	Decide(ctx context.Context, req *Request) Decision
+}
+
+// Engine holds the active policy. Policies are swapped atomically, so requests
+// in flight keep deciding against the policy they started with.
+type Engine struct {
+	policy atomic.Pointer[Policy]
+	logger *zerolog.Logger
+}
+
+func NewEngine(policy *Policy, logger *zerolog.Logger) *Engine {
+	e := &Engine{logger: logger}
+	if policy == nil {
+		policy = &Policy{}
+		policy.Compile()
+	}
+	e.policy.Store(policy)
+	return e
+}
+
+func (e *Engine) Policy() *Policy {
+	return e.policy.Load()
+}
+
+// Swap activates policy and returns the previous one. A nil policy is rejected with ErrNilPolicy.
+func (e *Engine) Swap(policy *Policy) (*Policy, error) {
+	if policy == nil {
+		return nil, ErrNilPolicy
+	}
+	return e.policy.Swap(policy), nil
+}
+
+func (e *Engine) Decide(_ context.Context, req *Request) Decision {
+	return e.policy.Load().Decide(req)
+}
+
+func (e *Engine) ReloadFile(path string) error {
+	policy, err := LoadFile(path)
+	if err != nil {
+		return err
+	}
+	if _, err := e.Swap(policy); err != nil {
+		return err
+	}
+	if e.logger != nil {
+		e.logger.Info().Str("path", path).Int("roles", len(policy.Roles)).Int("rules", len(policy.Rules)).Msg("Policy reloaded")
+	}
+	return nil
+}
+
+// WatchFile loads path and reloads it on every SIGHUP until ctx is done, and also when its
+// modification time changes if interval is positive. A policy that fails to load is logged
+// and the previous policy stays active.
+func (e *Engine) WatchFile(ctx context.Context, path string, interval time.Duration) error {
+	if err := e.ReloadFile(path); err != nil {
+		return err
+	}
+	modTime := fileModTime(path)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		tick = ticker.C
+		go func() {
+			<-ctx.Done()
+			ticker.Stop()
+		}()
+	}
+	hup := signal.Hangup(ctx)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+			case <-tick:
+				if current := fileModTime(path); current.Equal(modTime) {
+					continue
+				}
+			}
+			modTime = fileModTime(path)
+			if err := e.ReloadFile(path); err != nil && e.logger != nil {
+				e.logger.Error().Str("path", path).Err(err).Msg("Policy reload failed")
+			}
+		}
+	}()
+	return nil
+}
+
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,60 @@
+package policy
+
+import (
+	"net/http"
+
+	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/middleware"
+)
+
+// Require authorizes the request for action, with the subject and roles taken from the JWT claims
+// stored by middleware.JWTAuth, or from the principal of APIKey or BasicAuth.
+// Requests without a subject get 401, denied ones 403. Every decision is logged.
+func Require(decider Decider, action string) middleware.Set {
+	return middleware.Set{
+		Request: func(l *context.LuxContext) (*context.LuxContext, int) {
+			req := NewRequest(l, action)
+			if req.Subject == "" {
+				return l, http.StatusUnauthorized
+			}
+			decision := decider.Decide(l.RequestContext, req)
+			if l.Logger != nil {
+				event := l.Logger.Debug()
+				if !decision.Allowed {
+					event = l.Logger.Info()
+				}
+				event.Str("subject", req.Subject).Str("action", action).Str("route", l.RoutePattern).Str("remote", l.GetRemoteIP()).Bool("allowed", decision.Allowed).Str("reason", decision.Reason).Msg("Policy decision")
+			}
+			if !decision.Allowed {
+				return l, http.StatusForbidden
+			}
+			return l, http.StatusOK
+		},
+		Response: nil,
+	}
+}
+
+func NewRequest(l *context.LuxContext, action string) *Request {
+	req := &Request{
+		Subject: l.Principal,
+		Action:  action,
+		Params:  make(map[string]string, len(l.RouteParams)),
+		Attributes: map[string]string{
+			"method":    l.Request.Method,
+			"path":      l.Request.URL.Path,
+			"route":     l.RoutePattern,
+			"client_ip": l.GetRemoteIP(),
+		},
+	}
+	for _, param := range l.RouteParams {
+		req.Params[param.Key] = param.Value
+	}
+	if l.Claims != nil {
+		req.Claims = context.MapClaims(l.Claims)
+		if sub, _ := l.Claims.GetSubject(); sub != "" {
+			req.Subject = sub
+		}
+		req.Roles = context.ClaimStrings(req.Claims["roles"], req.Claims["role"])
+	}
+	return req
+}
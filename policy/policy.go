@@ -0,0 +1,252 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Request is what a decision is made on.
+type Request struct {
+	Subject string
+	Roles   []string
+	Claims  map[string]any
+	Action  string
+	// Params are the route parameters.
+	Params map[string]string
+	// Attributes describe the request: method, path, route and client_ip.
+	Attributes map[string]string
+}
+
+type Decision struct {
+	Allowed bool
+	// Reason names the rule or role that decided, or "default".
+	Reason string
+}
+
+type Role struct {
+	Inherits    []string `json:"inherits,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// Condition compares an attribute with Equals or with one of In. Attribute names subject, action,
+// claim.<name>, param.<name> or attr.<name>. Values are literals, or attribute references when they start with "$".
+// Equals is a pointer so that comparing with the empty string is distinct from leaving it unset.
+type Condition struct {
+	Attribute string   `json:"attribute"`
+	Equals    *string  `json:"equals,omitempty"`
+	In        []string `json:"in,omitempty"`
+}
+
+type Rule struct {
+	Name       string      `json:"name,omitempty"`
+	Effect     Effect      `json:"effect"`
+	Actions    []string    `json:"actions"`
+	Roles      []string    `json:"roles,omitempty"`
+	Conditions []Condition `json:"conditions,omitempty"`
+}
+
+// Policy grants actions through roles and rules. Deny rules win, then role permissions
+// and allow rules grant, and everything else is denied.
+type Policy struct {
+	Roles map[string]Role `json:"roles"`
+	Rules []Rule          `json:"rules"`
+
+	permissions map[string][]string
+}
+
+// Compile expands the role hierarchy. It must be called after building a Policy by hand.
+func (p *Policy) Compile() error {
+	p.permissions = make(map[string][]string, len(p.Roles))
+	for name := range p.Roles {
+		permissions, err := p.expand(name, map[string]bool{})
+		if err != nil {
+			return err
+		}
+		p.permissions[name] = permissions
+	}
+	for i, rule := range p.Rules {
+		if rule.Effect != Allow && rule.Effect != Deny {
+			return fmt.Errorf("policy: rule %d: unknown effect %q", i, rule.Effect)
+		}
+		if len(rule.Actions) == 0 {
+			return fmt.Errorf("policy: rule %d: no actions", i)
+		}
+	}
+	return nil
+}
+
+func (p *Policy) expand(name string, visiting map[string]bool) ([]string, error) {
+	if visiting[name] {
+		return nil, fmt.Errorf("policy: role %q inherits itself", name)
+	}
+	role, ok := p.Roles[name]
+	if !ok {
+		return nil, fmt.Errorf("policy: unknown role %q", name)
+	}
+	visiting[name] = true
+	defer delete(visiting, name)
+
+	permissions := append([]string(nil), role.Permissions...)
+	for _, parent := range role.Inherits {
+		inherited, err := p.expand(parent, visiting)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, inherited...)
+	}
+	return permissions, nil
+}
+
+func (p *Policy) Decide(req *Request) Decision {
+	for i := range p.Rules {
+		if rule := &p.Rules[i]; rule.Effect == Deny && rule.matches(req) {
+			return Decision{Allowed: false, Reason: rule.reason(i)}
+		}
+	}
+	for _, role := range req.Roles {
+		for _, permission := range p.permissions[role] {
+			if matchAction(permission, req.Action) {
+				return Decision{Allowed: true, Reason: "role " + role}
+			}
+		}
+	}
+	for i := range p.Rules {
+		if rule := &p.Rules[i]; rule.Effect == Allow && rule.matches(req) {
+			return Decision{Allowed: true, Reason: rule.reason(i)}
+		}
+	}
+	return Decision{Allowed: false, Reason: "default"}
+}
+
+func (r *Rule) reason(i int) string {
+	if r.Name != "" {
+		return "rule " + r.Name
+	}
+	return fmt.Sprintf("rule #%d", i)
+}
+
+func (r *Rule) matches(req *Request) bool {
+	matched := false
+	for _, action := range r.Actions {
+		if matchAction(action, req.Action) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	if len(r.Roles) > 0 && !hasAny(req.Roles, r.Roles) {
+		return false
+	}
+	for _, condition := range r.Conditions {
+		if !condition.holds(req) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Condition) holds(req *Request) bool {
+	value, ok := lookup(strings.TrimPrefix(c.Attribute, "$"), req)
+	if !ok {
+		return false
+	}
+	if c.Equals != nil {
+		want, ok := resolve(*c.Equals, req)
+		return ok && value == want
+	}
+	for _, candidate := range c.In {
+		if want, ok := resolve(candidate, req); ok && value == want {
+			return true
+		}
+	}
+	return false
+}
+
+func resolve(value string, req *Request) (string, bool) {
+	if name, ok := strings.CutPrefix(value, "$"); ok {
+		return lookup(name, req)
+	}
+	return value, true
+}
+
+func lookup(name string, req *Request) (string, bool) {
+	switch {
+	case name == "subject":
+		return req.Subject, req.Subject != ""
+	case name == "action":
+		return req.Action, true
+	case strings.HasPrefix(name, "claim."):
+		v, ok := req.Claims[strings.TrimPrefix(name, "claim.")]
+		if !ok || v == nil {
+			return "", false
+		}
+		return fmt.Sprint(v), true
+	case strings.HasPrefix(name, "param."):
+		v, ok := req.Params[strings.TrimPrefix(name, "param.")]
+		return v, ok
+	case strings.HasPrefix(name, "attr."):
+		v, ok := req.Attributes[strings.TrimPrefix(name, "attr.")]
+		return v, ok
+	}
+	return "", false
+}
+
+// matchAction matches "*", "orders:*" and exact permissions.
+func matchAction(pattern, action string) bool {
+	if pattern == "*" || pattern == action {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(action, prefix)
+	}
+	return false
+}
+
+func hasAny(held, wanted []string) bool {
+	for _, h := range held {
+		for _, w := range wanted {
+			if h == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func Parse(r io.Reader) (*Policy, error) {
+	p := &Policy{}
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(p); err != nil {
+		return nil, fmt.Errorf("policy: %w", err)
+	}
+	if err := p.Compile(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func LoadFile(path string) (*Policy, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
@@ -234,3 +234,21 @@ func (p *Provider) Construct(ctx context.Context) error {
 
 	return nil
 }
+
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+func (p *Provider) HealthCheckers() map[string]HealthChecker {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	checkers := make(map[string]HealthChecker)
+	for typ, v := range p.container {
+		if checker, ok := v.(HealthChecker); ok {
+			checkers[typ.String()] = checker
+		}
+	}
+
+	return checkers
+}
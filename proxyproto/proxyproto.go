@@ -0,0 +1,214 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/snowmerak/lux/util"
+)
+
+const DefaultHeaderTimeout = 5 * time.Second
+
+var (
+	ErrInvalidHeader = errors.New("proxyproto: invalid header")
+
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+)
+
+const v1MaxLength = 107
+
+// Listener reads PROXY protocol v1 and v2 headers from connections accepted from trusted sources.
+// A trusted connection without a valid header is closed, since the spec forbids guessing whether one is present.
+// Connections from other sources are passed through untouched, so a forged header is never honoured.
+type Listener struct {
+	net.Listener
+	trusted       *util.TrustedProxies
+	headerTimeout time.Duration
+}
+
+func NewListener(ln net.Listener, trusted *util.TrustedProxies, headerTimeout time.Duration) *Listener {
+	if headerTimeout <= 0 {
+		headerTimeout = DefaultHeaderTimeout
+	}
+	return &Listener{
+		Listener:      ln,
+		trusted:       trusted,
+		headerTimeout: headerTimeout,
+	}
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !l.trusted.Contains(net.ParseIP(util.GetIP(conn.RemoteAddr().String()))) {
+		return conn, nil
+	}
+	return &Conn{
+		Conn:          conn,
+		reader:        bufio.NewReader(conn),
+		headerTimeout: l.headerTimeout,
+	}, nil
+}
+
+// Conn parses the header lazily on the first Read, RemoteAddr or LocalAddr,
+// so a slow client never blocks the accept loop.
+type Conn struct {
+	net.Conn
+	reader        *bufio.Reader
+	headerTimeout time.Duration
+
+	once       sync.Once
+	err        error
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(p)
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *Conn) readHeader() {
+	c.Conn.SetReadDeadline(time.Now().Add(c.headerTimeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	if peek, err := c.reader.Peek(len(v1Prefix)); err == nil && bytes.Equal(peek, v1Prefix) {
+		c.err = c.readV1()
+	} else if peek, err := c.reader.Peek(len(v2Signature)); err == nil && bytes.Equal(peek, v2Signature) {
+		c.err = c.readV2()
+	} else {
+		c.err = ErrInvalidHeader
+	}
+	if c.err != nil {
+		c.Conn.Close()
+	}
+}
+
+func (c *Conn) readV1() error {
+	line := make([]byte, 0, v1MaxLength)
+	for {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= v1MaxLength {
+			return ErrInvalidHeader
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return ErrInvalidHeader
+	}
+
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) < 2 {
+		return ErrInvalidHeader
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		return nil
+	case "TCP4", "TCP6":
+	default:
+		return ErrInvalidHeader
+	}
+	if len(fields) != 6 {
+		return ErrInvalidHeader
+	}
+	src := net.ParseIP(fields[2])
+	dst := net.ParseIP(fields[3])
+	srcPort, err1 := strconv.ParseUint(fields[4], 10, 16)
+	dstPort, err2 := strconv.ParseUint(fields[5], 10, 16)
+	if src == nil || dst == nil || err1 != nil || err2 != nil {
+		return ErrInvalidHeader
+	}
+	c.remoteAddr = &net.TCPAddr{IP: src, Port: int(srcPort)}
+	c.localAddr = &net.TCPAddr{IP: dst, Port: int(dstPort)}
+	return nil
+}
+
+func (c *Conn) readV2() error {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return err
+	}
+	if header[12]>>4 != 2 {
+		return ErrInvalidHeader
+	}
+	command := header[12] & 0x0F
+	family := header[13]
+	length := binary.BigEndian.Uint16(header[14:16])
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return err
+	}
+
+	switch command {
+	case 0x0:
+		// LOCAL: health checks from the proxy itself, keep the real addresses.
+		return nil
+	case 0x1:
+	default:
+		return ErrInvalidHeader
+	}
+
+	switch family >> 4 {
+	case 0x1:
+		if len(payload) < 12 {
+			return ErrInvalidHeader
+		}
+		c.remoteAddr, c.localAddr = v2Addrs(family, payload[0:4], payload[4:8], payload[8:10], payload[10:12])
+	case 0x2:
+		if len(payload) < 36 {
+			return ErrInvalidHeader
+		}
+		c.remoteAddr, c.localAddr = v2Addrs(family, payload[0:16], payload[16:32], payload[32:34], payload[34:36])
+	default:
+		// AF_UNSPEC and AF_UNIX carry nothing we can use as an IP address.
+	}
+	return nil
+}
+
+func v2Addrs(family byte, src, dst, srcPort, dstPort []byte) (net.Addr, net.Addr) {
+	srcIP := net.IP(append([]byte(nil), src...))
+	dstIP := net.IP(append([]byte(nil), dst...))
+	sp := int(binary.BigEndian.Uint16(srcPort))
+	dp := int(binary.BigEndian.Uint16(dstPort))
+	if family&0x0F == 0x2 {
+		return &net.UDPAddr{IP: srcIP, Port: sp}, &net.UDPAddr{IP: dstIP, Port: dp}
+	}
+	return &net.TCPAddr{IP: srcIP, Port: sp}, &net.TCPAddr{IP: dstIP, Port: dp}
+}
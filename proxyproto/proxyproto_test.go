@@ -0,0 +1,173 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/snowmerak/lux/util"
+)
+
+func v2Header(command, family byte, payload []byte) []byte {
+	header := append([]byte(nil), v2Signature...)
+	header = append(header, 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:16], uint16(len(payload)))
+	return append(header, payload...)
+}
+
+func v2TCP4(src, dst string, srcPort, dstPort uint16) []byte {
+	payload := append(net.ParseIP(src).To4(), net.ParseIP(dst).To4()...)
+	payload = binary.BigEndian.AppendUint16(payload, srcPort)
+	return binary.BigEndian.AppendUint16(payload, dstPort)
+}
+
+func v2TCP6(src, dst string, srcPort, dstPort uint16) []byte {
+	payload := append(net.ParseIP(src).To16(), net.ParseIP(dst).To16()...)
+	payload = binary.BigEndian.AppendUint16(payload, srcPort)
+	return binary.BigEndian.AppendUint16(payload, dstPort)
+}
+
+func TestConnHeaders(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		header []byte
+		remote string
+		local  string
+		err    error
+	}{
+		{name: "v1 TCP4", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n"), remote: "192.0.2.1:56324", local: "198.51.100.1:443"},
+		{name: "v1 TCP6", header: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 1000 443\r\n"), remote: "[2001:db8::1]:1000", local: "[2001:db8::2]:443"},
+		{name: "v1 UNKNOWN", header: []byte("PROXY UNKNOWN\r\n"), remote: "pipe", local: "pipe"},
+		{name: "v1 UNKNOWN with addresses", header: []byte("PROXY UNKNOWN 192.0.2.1 198.51.100.1 1 2\r\n"), remote: "pipe", local: "pipe"},
+		{name: "v1 over 107 bytes", header: []byte("PROXY TCP4 " + strings.Repeat("1", 100) + "\r\n"), err: ErrInvalidHeader},
+		{name: "v1 without CRLF", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\n"), err: ErrInvalidHeader},
+		{name: "v1 bad port", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 99999 443\r\n"), err: ErrInvalidHeader},
+		{name: "v1 bad protocol", header: []byte("PROXY UDP4 192.0.2.1 198.51.100.1 1 2\r\n"), err: ErrInvalidHeader},
+		{name: "v2 TCP4", header: v2Header(0x1, 0x11, v2TCP4("192.0.2.1", "198.51.100.1", 56324, 443)), remote: "192.0.2.1:56324", local: "198.51.100.1:443"},
+		{name: "v2 TCP6", header: v2Header(0x1, 0x21, v2TCP6("2001:db8::1", "2001:db8::2", 1000, 443)), remote: "[2001:db8::1]:1000", local: "[2001:db8::2]:443"},
+		{name: "v2 TCP4 with TLVs", header: v2Header(0x1, 0x11, append(v2TCP4("192.0.2.1", "198.51.100.1", 1, 2), 0x04, 0x00, 0x01, 0xff)), remote: "192.0.2.1:1", local: "198.51.100.1:2"},
+		{name: "v2 LOCAL", header: v2Header(0x0, 0x00, nil), remote: "pipe", local: "pipe"},
+		{name: "v2 AF_UNIX", header: v2Header(0x1, 0x31, make([]byte, 216)), remote: "pipe", local: "pipe"},
+		{name: "v2 short TCP4 payload", header: v2Header(0x1, 0x11, make([]byte, 8)), err: ErrInvalidHeader},
+		{name: "v2 truncated payload", header: v2Header(0x1, 0x11, v2TCP4("192.0.2.1", "198.51.100.1", 1, 2))[:20], err: io.ErrUnexpectedEOF},
+		{name: "v2 bad version", header: append(append([]byte(nil), v2Signature...), 0x11, 0x11, 0, 0), err: ErrInvalidHeader},
+		{name: "v2 bad command", header: v2Header(0x2, 0x11, v2TCP4("192.0.2.1", "198.51.100.1", 1, 2)), err: ErrInvalidHeader},
+		{name: "no header", header: []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"), err: ErrInvalidHeader},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer client.Close()
+			go func() {
+				client.Write(append(tc.header, "hello"...))
+				client.Close()
+			}()
+			conn := &Conn{Conn: server, reader: bufio.NewReader(server), headerTimeout: time.Second}
+			defer conn.Close()
+
+			body, err := io.ReadAll(conn)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("Read = %v, want %v", err, tc.err)
+				}
+				if _, err := server.Write([]byte("x")); !errors.Is(err, io.ErrClosedPipe) {
+					t.Errorf("connection is not closed after an invalid header: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if string(body) != "hello" {
+				t.Errorf("body = %q", body)
+			}
+			if got := conn.RemoteAddr().String(); got != tc.remote {
+				t.Errorf("RemoteAddr = %s, want %s", got, tc.remote)
+			}
+			if got := conn.LocalAddr().String(); got != tc.local {
+				t.Errorf("LocalAddr = %s, want %s", got, tc.local)
+			}
+		})
+	}
+}
+
+func TestConnHeaderTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	conn := &Conn{Conn: server, reader: bufio.NewReader(server), headerTimeout: 20 * time.Millisecond}
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("Read succeeded without a header")
+	}
+}
+
+func listen(t *testing.T, cidr string) *Listener {
+	t.Helper()
+	trusted, err := util.NewTrustedProxies(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return NewListener(ln, trusted, time.Second)
+}
+
+// roundTrip sends data to ln and returns the accepted connection with what it read.
+func roundTrip(t *testing.T, ln *Listener, data []byte) (net.Conn, []byte, error) {
+	t.Helper()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	client.(*net.TCPConn).CloseWrite()
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	body, err := io.ReadAll(conn)
+	return conn, body, err
+}
+
+func TestListenerIgnoresUntrustedHeader(t *testing.T) {
+	ln := listen(t, "10.0.0.0/8")
+	forged := []byte("PROXY TCP4 203.0.113.7 198.51.100.1 1234 443\r\nhello")
+	conn, body, err := roundTrip(t, ln, forged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, forged) {
+		t.Errorf("untrusted connection read %q, want the forged header untouched", body)
+	}
+	if ip := util.GetIP(conn.RemoteAddr().String()); ip != "127.0.0.1" {
+		t.Errorf("untrusted RemoteAddr = %s, want the real peer", conn.RemoteAddr())
+	}
+}
+
+func TestListenerTrustedPeer(t *testing.T) {
+	ln := listen(t, "127.0.0.1/32")
+	conn, body, err := roundTrip(t, ln, []byte("PROXY TCP4 203.0.113.7 198.51.100.1 1234 443\r\nhello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "hello" || conn.RemoteAddr().String() != "203.0.113.7:1234" {
+		t.Errorf("trusted connection = %q from %s", body, conn.RemoteAddr())
+	}
+
+	_, _, err = roundTrip(t, ln, []byte("GET / HTTP/1.1\r\n\r\n"))
+	if !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("trusted connection without a header = %v, want ErrInvalidHeader", err)
+	}
+}
@@ -0,0 +1,352 @@
+package refresh
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
+	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/store/keyvalue"
+)
+
+const (
+	DefaultTTL    = 30 * 24 * time.Hour
+	DefaultPrefix = "lux:refresh:"
+)
+
+var (
+	ErrInvalidToken = errors.New("refresh: invalid token")
+	ErrTokenReused  = errors.New("refresh: token reused, family revoked")
+)
+
+type Config struct {
+	// Store must return keyvalue.ErrNotFound, or a nil value, for missing keys. Other Get errors fail the call.
+	Store keyvalue.KeyValue
+	// TTL is the lifetime of each refresh token. Every rotation starts a new TTL. Zero means DefaultTTL.
+	TTL time.Duration
+	// Prefix namespaces the keys in Store. Empty means DefaultPrefix.
+	Prefix string
+	Logger *zerolog.Logger
+}
+
+// Manager issues refresh tokens in families. Each family only honours its latest token:
+// presenting an older one means it was stolen or replayed, so the whole family is revoked.
+// Reuse detection is serialized by a mutex of the Manager, not by the store, so it is not atomic
+// across replicas sharing one keyvalue.KeyValue: two of them may both accept the same token once.
+type Manager struct {
+	cfg  Config
+	lock sync.Mutex
+}
+
+type Token struct {
+	ID        string
+	FamilyID  string
+	Subject   string
+	ExpiresAt time.Time
+	Value     string
+}
+
+type claims struct {
+	jwt.RegisteredClaims
+	FamilyID string `json:"fid"`
+}
+
+type family struct {
+	Subject   string    `json:"subject"`
+	Current   string    `json:"current"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type subjectIndex struct {
+	Families map[string]time.Time `json:"families"`
+}
+
+func NewManager(cfg Config) *Manager {
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = DefaultPrefix
+	}
+	return &Manager{cfg: cfg}
+}
+
+// Issue starts a new family for subject, typically at login, and sets the refresh token cookie.
+func (m *Manager) Issue(l *context.LuxContext, subject string) (*Token, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	familyID, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	token, err := m.rotate(l, familyID, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := m.loadSubject(subject)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for id, expiresAt := range index.Families {
+		if now.After(expiresAt) {
+			delete(index.Families, id)
+			if err := m.cfg.Store.Delete(m.familyKey(id)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	index.Families[familyID] = token.ExpiresAt
+	if err := m.save(m.subjectKey(subject), index); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// Refresh consumes the refresh token cookie and sets its successor.
+// A token that was already consumed revokes its family and returns ErrTokenReused.
+func (m *Manager) Refresh(l *context.LuxContext) (*Token, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	parsed, err := m.parse(l)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.loadFamily(parsed.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if f == nil || f.Subject != parsed.Subject {
+		return nil, ErrInvalidToken
+	}
+	if f.Current != parsed.ID {
+		if err := m.revoke(parsed.FamilyID, f.Subject); err != nil {
+			return nil, err
+		}
+		if m.cfg.Logger != nil {
+			m.cfg.Logger.Warn().Str("subject", f.Subject).Str("family", parsed.FamilyID).Str("remote", l.GetRemoteIP()).Msg("Refresh token reused, family revoked")
+		}
+		return nil, ErrTokenReused
+	}
+
+	token, err := m.rotate(l, parsed.FamilyID, f.Subject)
+	if err != nil {
+		return nil, err
+	}
+	index, err := m.loadSubject(f.Subject)
+	if err != nil {
+		return nil, err
+	}
+	index.Families[parsed.FamilyID] = token.ExpiresAt
+	if err := m.save(m.subjectKey(f.Subject), index); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// Logout revokes the family of the refresh token cookie, if any, and clears the cookie.
+func (m *Manager) Logout(l *context.LuxContext) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if l.JWT() != nil {
+		l.JWT().ClearRefreshToken()
+	}
+	parsed, err := m.parse(l)
+	if err != nil {
+		return nil
+	}
+	return m.revoke(parsed.FamilyID, parsed.Subject)
+}
+
+// LogoutAll revokes every family of the subject of the refresh token cookie and clears the cookie.
+func (m *Manager) LogoutAll(l *context.LuxContext) error {
+	parsed, err := m.parse(l)
+	if l.JWT() != nil {
+		l.JWT().ClearRefreshToken()
+	}
+	if err != nil {
+		return nil
+	}
+	return m.RevokeAll(parsed.Subject)
+}
+
+func (m *Manager) Revoke(familyID string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	f, err := m.loadFamily(familyID)
+	if err != nil || f == nil {
+		return err
+	}
+	return m.revoke(familyID, f.Subject)
+}
+
+// RevokeAll revokes every family of subject, signing it out everywhere.
+func (m *Manager) RevokeAll(subject string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	index, err := m.loadSubject(subject)
+	if err != nil {
+		return err
+	}
+	for id := range index.Families {
+		if err := m.cfg.Store.Delete(m.familyKey(id)); err != nil {
+			return err
+		}
+	}
+	return m.cfg.Store.Delete(m.subjectKey(subject))
+}
+
+func (m *Manager) rotate(l *context.LuxContext, familyID, subject string) (*Token, error) {
+	j := l.JWT()
+	if j == nil {
+		return nil, errors.New("refresh: JWT config is not set")
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	expiresAt := now.Add(m.cfg.TTL)
+	value, err := j.MakeRefreshToken(&claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		FamilyID: familyID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := m.save(m.familyKey(familyID), &family{Subject: subject, Current: id, ExpiresAt: expiresAt}); err != nil {
+		return nil, err
+	}
+	j.SetRefreshTokenCookie(value, expiresAt)
+	return &Token{ID: id, FamilyID: familyID, Subject: subject, ExpiresAt: expiresAt, Value: value}, nil
+}
+
+func (m *Manager) parse(l *context.LuxContext) (*Token, error) {
+	j := l.JWT()
+	if j == nil {
+		return nil, ErrInvalidToken
+	}
+	parsed, err := j.GetRefreshTokenFromCookie()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	mc, ok := parsed.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	token := &Token{}
+	token.ID, _ = mc["jti"].(string)
+	token.FamilyID, _ = mc["fid"].(string)
+	token.Subject, _ = mc["sub"].(string)
+	if token.ID == "" || token.FamilyID == "" {
+		return nil, ErrInvalidToken
+	}
+	return token, nil
+}
+
+func (m *Manager) revoke(familyID, subject string) error {
+	if err := m.cfg.Store.Delete(m.familyKey(familyID)); err != nil {
+		return err
+	}
+	index, err := m.loadSubject(subject)
+	if err != nil {
+		return err
+	}
+	delete(index.Families, familyID)
+	if len(index.Families) == 0 {
+		return m.cfg.Store.Delete(m.subjectKey(subject))
+	}
+	return m.save(m.subjectKey(subject), index)
+}
+
+func (m *Manager) loadFamily(id string) (*family, error) {
+	f := &family{}
+	found, err := m.load(m.familyKey(id), f)
+	if err != nil || !found {
+		return nil, err
+	}
+	if time.Now().After(f.ExpiresAt) {
+		return nil, nil
+	}
+	return f, nil
+}
+
+func (m *Manager) loadSubject(subject string) (*subjectIndex, error) {
+	index := &subjectIndex{}
+	if _, err := m.load(m.subjectKey(subject), index); err != nil {
+		return nil, err
+	}
+	if index.Families == nil {
+		index.Families = map[string]time.Time{}
+	}
+	return index, nil
+}
+
+// load reports a missing key as not found. Any other store error is returned, so an
+// unreachable store never looks like an empty subject index.
+func (m *Manager) load(key string, v any) (bool, error) {
+	value, err := m.cfg.Store.Get(key)
+	if errors.Is(err, keyvalue.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if value == nil {
+		return false, nil
+	}
+	var raw []byte
+	switch value := value.(type) {
+	case []byte:
+		raw = value
+	case string:
+		raw = []byte(value)
+	default:
+		return false, fmt.Errorf("refresh: unexpected value type %T for %s", value, key)
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (m *Manager) save(key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return m.cfg.Store.Set(key, raw)
+}
+
+func (m *Manager) familyKey(id string) string {
+	return m.cfg.Prefix + "family:" + id
+}
+
+func (m *Manager) subjectKey(subject string) string {
+	return m.cfg.Prefix + "subject:" + subject
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,40 @@
+package lux
+
+import (
+	"sort"
+
+	"github.com/snowmerak/lux/router"
+)
+
+type Route struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Middlewares []string `json:"middlewares,omitempty"`
+}
+
+func newRoute(method, path string, rg *router.RouterGroup, r *router.Router) Route {
+	route := Route{
+		Method: method,
+		Path:   path,
+	}
+	for _, m := range rg.Middlewares {
+		route.Middlewares = append(route.Middlewares, m.String())
+	}
+	for _, m := range r.Middlewares {
+		route.Middlewares = append(route.Middlewares, m.String())
+	}
+	return route
+}
+
+func sortRoutes(routes []Route) {
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+}
+
+func (l *Lux) Routes() []Route {
+	return append([]Route(nil), l.routeTable...)
+}
@@ -15,6 +15,7 @@ func (l *Lux) NewRouterGroup(path string, middlewares ...middleware.Set) *router
 		SubRouterGroups: []*router.RouterGroup{},
 		Logger:          l.logger,
 		Swagger:         l.swagger,
+		Metrics:         l.metrics,
 	}
 	rg.Path = strings.TrimSuffix(rg.Path, "/")
 	l.routers = append(l.routers, rg)
@@ -0,0 +1,129 @@
+package router
+
+import (
+	ctx "context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/handler"
+	"github.com/snowmerak/lux/middleware"
+)
+
+func (r *Router) SetMaxBodySize(size int64) *Router {
+	r.MaxBodySize = size
+	return r
+}
+
+func (r *Router) SetTimeout(timeout time.Duration) *Router {
+	r.Timeout = timeout
+	return r
+}
+
+func (r *Router) SetTimeoutStatus(status int) *Router {
+	r.TimeoutStatus = status
+	return r
+}
+
+func (r *RouterGroup) SetMaxBodySize(size int64) {
+	r.MaxBodySize = size
+}
+
+func (r *RouterGroup) SetTimeout(timeout time.Duration) {
+	r.Timeout = timeout
+}
+
+func (r *RouterGroup) SetTimeoutStatus(status int) {
+	r.TimeoutStatus = status
+}
+
+// withLimits applies the route body limit, falling back to the group one, when the request is served,
+// so limits set after the route was added still take effect.
+func (r *RouterGroup) withLimits(router *Router, next handler.Handler) handler.Handler {
+	return func(l *context.LuxContext) error {
+		maxBodySize := router.MaxBodySize
+		if maxBodySize == 0 {
+			maxBodySize = r.MaxBodySize
+		}
+		if maxBodySize > 0 && l.Request.Body != nil && l.Request.Body != http.NoBody {
+			if l.Request.ContentLength > maxBodySize {
+				l.Response.StatusCode = http.StatusRequestEntityTooLarge
+				return &http.MaxBytesError{Limit: maxBodySize}
+			}
+			l.Request.Body = http.MaxBytesReader(l.Response, l.Request.Body, maxBodySize)
+		}
+
+		err := next(l)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) || errors.Is(err, middleware.ErrDecompressionRatio) {
+			l.Response.StatusCode = http.StatusRequestEntityTooLarge
+		}
+		return err
+	}
+}
+
+// withTimeout puts only the handler under the route timeout. The middlewares run on l itself,
+// so the claims, principal and context values they store outlive a timed route.
+func (r *RouterGroup) withTimeout(router *Router, next handler.Handler) handler.Handler {
+	return func(l *context.LuxContext) error {
+		timeout := router.Timeout
+		if timeout == 0 {
+			timeout = r.Timeout
+		}
+		if timeout <= 0 {
+			return next(l)
+		}
+		status := router.TimeoutStatus
+		if status == 0 {
+			status = r.TimeoutStatus
+		}
+		if status == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		return runWithTimeout(l, timeout, status, next)
+	}
+}
+
+// runWithTimeout runs next on a copy of l with its own response, so a handler that outlives
+// the deadline cannot touch the response that has already been sent.
+func runWithTimeout(l *context.LuxContext, timeout time.Duration, status int, next func(*context.LuxContext) error) error {
+	parent := l.RequestContext
+	if parent == nil {
+		parent = l.Request.Context()
+	}
+	reqCtx, cancel := ctx.WithTimeout(parent, timeout)
+	defer cancel()
+
+	inner := *l
+	inner.Response = &context.Response{
+		StatusCode: l.Response.StatusCode,
+		Headers:    l.Response.Headers.Clone(),
+		Body:       append([]byte(nil), l.Response.Body...),
+	}
+	inner.RequestContext = reqCtx
+	inner.Request = l.Request.WithContext(context.WithLuxContext(reqCtx, &inner))
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				inner.Response.StatusCode = http.StatusInternalServerError
+				done <- fmt.Errorf("router: handler panic: %v", p)
+			}
+		}()
+		done <- next(&inner)
+	}()
+
+	select {
+	case err := <-done:
+		*l.Response = *inner.Response
+		return err
+	case <-reqCtx.Done():
+		l.Response.StatusCode = status
+		l.Response.Body = []byte(http.StatusText(status))
+		l.Response.Headers.Set("Content-Type", "text/plain; charset=utf-8")
+		return http.ErrHandlerTimeout
+	}
+}
@@ -0,0 +1,140 @@
+package router
+
+import (
+	ctx "context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/handler"
+	"github.com/snowmerak/lux/middleware"
+)
+
+func newGroup() *RouterGroup {
+	logger := zerolog.Nop()
+	return &RouterGroup{Routers: map[string]map[string]*Router{}, Logger: &logger}
+}
+
+func serve(router *Router, r *http.Request) (*context.LuxContext, error) {
+	l := &context.LuxContext{Response: context.NewResponse()}
+	l.Request = r.WithContext(context.WithLuxContext(r.Context(), l))
+	l.RequestContext = l.Request.Context()
+	return l, router.Handler(l)
+}
+
+func readAll(l *context.LuxContext) error {
+	_, err := io.ReadAll(l.Request.Body)
+	return err
+}
+
+func TestMaxBodySize(t *testing.T) {
+	g := newGroup()
+	g.SetMaxBodySize(8)
+	router := g.AddRouter(http.MethodPost, "/", readAll, nil)
+
+	l, err := serve(router, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("short")))
+	if err != nil || l.Response.StatusCode != http.StatusOK {
+		t.Fatalf("body under the limit = %d, %v", l.Response.StatusCode, err)
+	}
+
+	l, err = serve(router, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("far too long")))
+	if err == nil || l.Response.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("declared body over the limit = %d, %v", l.Response.StatusCode, err)
+	}
+
+	chunked := httptest.NewRequest(http.MethodPost, "/", io.NopCloser(strings.NewReader("far too long")))
+	chunked.ContentLength = -1
+	l, err = serve(router, chunked)
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) || l.Response.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("streamed body over the limit = %d, %v", l.Response.StatusCode, err)
+	}
+
+	router.SetMaxBodySize(64)
+	l, err = serve(router, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("far too long")))
+	if err != nil || l.Response.StatusCode != http.StatusOK {
+		t.Fatalf("route limit over the group one = %d, %v", l.Response.StatusCode, err)
+	}
+}
+
+func waitForDeadline(l *context.LuxContext) error {
+	<-l.RequestContext.Done()
+	return l.RequestContext.Err()
+}
+
+func TestTimeout(t *testing.T) {
+	g := newGroup()
+	g.SetTimeout(20 * time.Millisecond)
+	router := g.AddRouter(http.MethodGet, "/", waitForDeadline, nil)
+
+	l, err := serve(router, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !errors.Is(err, http.ErrHandlerTimeout) || l.Response.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("timed out route = %d, %v", l.Response.StatusCode, err)
+	}
+
+	router.SetTimeoutStatus(http.StatusGatewayTimeout)
+	l, err = serve(router, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !errors.Is(err, http.ErrHandlerTimeout) || l.Response.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf("timed out route with TimeoutStatus = %d, %v", l.Response.StatusCode, err)
+	}
+
+	fast := g.AddRouter(http.MethodGet, "/fast", func(l *context.LuxContext) error {
+		return l.ReplyString("ok")
+	}, nil)
+	l, err = serve(fast, httptest.NewRequest(http.MethodGet, "/fast", nil))
+	if err != nil || l.Response.StatusCode != http.StatusOK || string(l.Response.Body) != "ok" {
+		t.Fatalf("fast route = %d %q, %v", l.Response.StatusCode, l.Response.Body, err)
+	}
+}
+
+func TestTimeoutRecoversPanic(t *testing.T) {
+	g := newGroup()
+	g.SetTimeout(time.Second)
+	router := g.AddRouter(http.MethodGet, "/", func(l *context.LuxContext) error {
+		panic("boom")
+	}, nil)
+
+	l, err := serve(router, httptest.NewRequest(http.MethodGet, "/", nil))
+	if err == nil || !strings.Contains(err.Error(), "boom") || l.Response.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("panicking handler = %d, %v", l.Response.StatusCode, err)
+	}
+}
+
+type principalKey struct{}
+
+func TestTimeoutKeepsMiddlewareState(t *testing.T) {
+	authenticate := middleware.Set{Request: func(l *context.LuxContext) (*context.LuxContext, int) {
+		l.Principal = "alice"
+		l.RequestContext = ctx.WithValue(l.RequestContext, principalKey{}, "alice")
+		return l, http.StatusOK
+	}}
+	var seen string
+	var h handler.Handler = func(l *context.LuxContext) error {
+		seen, _ = l.RequestContext.Value(principalKey{}).(string)
+		return nil
+	}
+	g := newGroup()
+	g.SetTimeout(time.Second)
+	g.UseMiddlewares(authenticate)
+	router := g.AddRouter(http.MethodGet, "/", h, nil)
+
+	l, err := serve(router, httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen != "alice" {
+		t.Errorf("handler saw %q in RequestContext", seen)
+	}
+	if l.Principal != "alice" || l.RequestContext.Value(principalKey{}) != "alice" {
+		t.Errorf("middleware state lost after a timed route: principal %q, value %v", l.Principal, l.RequestContext.Value(principalKey{}))
+	}
+	if l.RequestContext.Err() != nil {
+		t.Errorf("RequestContext is cancelled after the handler: %v", l.RequestContext.Err())
+	}
+}
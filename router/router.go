@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/snowmerak/lux/context"
 	"github.com/snowmerak/lux/handler"
@@ -20,6 +21,12 @@ type Router struct {
 	Middlewares []middleware.Set
 	Method      string
 
+	// MaxBodySize limits the request body in bytes and answers 413 beyond it. Zero uses the group limit.
+	MaxBodySize int64
+	// Timeout cancels RequestContext and answers TimeoutStatus, 503 by default, once it passes. Zero uses the group timeout.
+	Timeout       time.Duration
+	TimeoutStatus int
+
 	logger *zerolog.Logger
 }
 
@@ -147,6 +154,6 @@ func (r *RouterGroup) Embedded(path string, embed fs.FS, middlewares ...middlewa
 }
 
 func (r *RouterGroup) Websocket(path string, wsHandler handler.WSHandler, middlewares ...middleware.Set) *Router {
-	handler := handler.WSWrap(wsHandler)
+	handler := handler.WSWrap(wsHandler, r.Metrics)
 	return r.AddRouter("GET", path, handler, nil, middlewares...)
 }
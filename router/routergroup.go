@@ -3,9 +3,11 @@ package router
 import (
 	"github.com/rs/zerolog"
 	"strings"
+	"time"
 
 	"github.com/snowmerak/lux/context"
 	"github.com/snowmerak/lux/handler"
+	"github.com/snowmerak/lux/metrics"
 	"github.com/snowmerak/lux/middleware"
 	"github.com/snowmerak/lux/swagger"
 )
@@ -17,6 +19,12 @@ type RouterGroup struct {
 	SubRouterGroups []*RouterGroup
 	Logger          *zerolog.Logger
 	Swagger         *swagger.Swagger
+	Metrics         *metrics.Metrics
+
+	// MaxBodySize, Timeout and TimeoutStatus are the defaults for routes that do not set their own.
+	MaxBodySize   int64
+	Timeout       time.Duration
+	TimeoutStatus int
 }
 
 func (r *RouterGroup) UseMiddlewares(middlewares ...middleware.Set) {
@@ -33,35 +41,42 @@ func (r *RouterGroup) AddRouter(method, path string, handler handler.Handler, sw
 		if _, ok := r.Swagger.Paths[swagger.Path(p)]; !ok {
 			r.Swagger.Paths[swagger.Path(p)] = map[swagger.Method]swagger.Router{}
 		}
-		r.Swagger.Paths[swagger.Path(p)][swagger.Method(m)] = *swaggerRouter
+		documented := *swaggerRouter
+		for _, set := range append(append([]middleware.Set(nil), r.Middlewares...), middlewares...) {
+			if set.Describe != nil {
+				set.Describe(r.Swagger, &documented)
+			}
+		}
+		r.Swagger.Paths[swagger.Path(p)][swagger.Method(m)] = documented
+	}
+	router := &Router{
+		Middlewares: middlewares,
+		logger:      r.Logger,
 	}
+	timed := r.withTimeout(router, handler)
 	newHandler := func(ctx *context.LuxContext) error {
 		if rs := middleware.ApplyRequests(ctx, r.Middlewares); rs != "" {
-			r.Logger.Error().Str("method", ctx.Request.Method).Str("path", ctx.Request.URL.Path).Str("remote", ctx.Request.RemoteAddr).Str("err", rs).Msg("Router group middleware error")
+			r.Logger.Error().Str("method", ctx.Request.Method).Str("path", ctx.Request.URL.Path).Str("remote", ctx.GetRemoteIP()).Str("err", rs).Msg("Router group middleware error")
 			return nil
 		}
 		if rs := middleware.ApplyRequests(ctx, middlewares); rs != "" {
-			r.Logger.Error().Str("method", ctx.Request.Method).Str("path", ctx.Request.URL.Path).Str("remote", ctx.Request.RemoteAddr).Str("err", rs).Msg("Router middleware error")
+			r.Logger.Error().Str("method", ctx.Request.Method).Str("path", ctx.Request.URL.Path).Str("remote", ctx.GetRemoteIP()).Str("err", rs).Msg("Router middleware error")
 			return nil
 		}
-		if err := handler(ctx); err != nil {
+		if err := timed(ctx); err != nil {
 			return err
 		}
 		if rs := middleware.ApplyResponses(ctx, middlewares); rs != "" {
-			r.Logger.Error().Str("method", ctx.Request.Method).Str("path", ctx.Request.URL.Path).Str("remote", ctx.Request.RemoteAddr).Str("err", rs).Msg("Router middleware error")
+			r.Logger.Error().Str("method", ctx.Request.Method).Str("path", ctx.Request.URL.Path).Str("remote", ctx.GetRemoteIP()).Str("err", rs).Msg("Router middleware error")
 			return nil
 		}
 		if rs := middleware.ApplyResponses(ctx, r.Middlewares); rs != "" {
-			r.Logger.Error().Str("method", ctx.Request.Method).Str("path", ctx.Request.URL.Path).Str("remote", ctx.Request.RemoteAddr).Str("err", rs).Msg("Router group middleware error")
+			r.Logger.Error().Str("method", ctx.Request.Method).Str("path", ctx.Request.URL.Path).Str("remote", ctx.GetRemoteIP()).Str("err", rs).Msg("Router group middleware error")
 			return nil
 		}
 		return nil
 	}
-	router := &Router{
-		Handler:     newHandler,
-		Middlewares: middlewares,
-		logger:      r.Logger,
-	}
+	router.Handler = r.withLimits(router, newHandler)
 	if _, ok := r.Routers[r.Path+path]; !ok {
 		r.Routers[r.Path+path] = map[string]*Router{}
 	}
@@ -1,6 +1,7 @@
 package signal
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -22,3 +23,28 @@ func Terminate() <-chan struct{} {
 
 	return done
 }
+
+// Hangup reports SIGHUP on the returned channel until ctx is done, then stops listening for it.
+func Hangup(ctx context.Context) <-chan struct{} {
+	sigs := make(chan os.Signal, 1)
+	hup := make(chan struct{}, 1)
+
+	signal.Notify(sigs, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(sigs)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sigs:
+				select {
+				case hup <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return hup
+}
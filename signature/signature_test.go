@@ -0,0 +1,243 @@
+package signature
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/store/keyvalue"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// memoryStore is a keyvalue.KeyValue that can be made to fail.
+type memoryStore struct {
+	lock   sync.Mutex
+	values map[string]any
+	err    error
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{values: map[string]any{}}
+}
+
+func (m *memoryStore) Set(key string, value any) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.err != nil {
+		return m.err
+	}
+	m.values[key] = value
+	return nil
+}
+
+func (m *memoryStore) Get(key string) (any, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.err != nil {
+		return nil, m.err
+	}
+	value, ok := m.values[key]
+	if !ok {
+		return nil, keyvalue.ErrNotFound
+	}
+	return value, nil
+}
+
+func (m *memoryStore) Delete(key string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.values, key)
+	return nil
+}
+
+func (m *memoryStore) Clear() error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.values = map[string]any{}
+	return nil
+}
+
+func newRequest(t *testing.T, body string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "https://API.example/pay?amount=10", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func signed(t *testing.T, signer *Signer, body string) *http.Request {
+	t.Helper()
+	req := newRequest(t, body)
+	if err := signer.Sign(req); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+// signAt signs req like Signer.Sign, but with a chosen created time.
+func signAt(t *testing.T, req *http.Request, keyID string, created time.Time) {
+	t.Helper()
+	req.Header.Set("Content-Digest", contentDigest(nil))
+	p := &params{components: DefaultComponents, created: created.Unix(), keyID: keyID, nonce: "n-" + created.String(), alg: Algorithm}
+	serialized := p.serialize()
+	base, err := signatureBase(req, p, serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Signature-Input", DefaultLabel+"="+serialized)
+	req.Header.Set("Signature", DefaultLabel+"=:"+base64.StdEncoding.EncodeToString(sign(testKey, base))+":")
+}
+
+func TestSignatureBase(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://Example.COM/a%20b?x=1&y=2", nil)
+	req.Header.Add("X-Custom", "  first ")
+	req.Header.Add("X-Custom", "second")
+	p := &params{
+		components: []string{"@method", "@authority", "@path", "@query", "x-custom"},
+		created:    1700000000,
+		keyID:      "billing",
+		nonce:      "abc",
+		alg:        Algorithm,
+	}
+	serialized := p.serialize()
+	if want := `("@method" "@authority" "@path" "@query" "x-custom");created=1700000000;keyid="billing";nonce="abc";alg="hmac-sha256"`; serialized != want {
+		t.Fatalf("serialize =\n%s\nwant\n%s", serialized, want)
+	}
+	base, err := signatureBase(req, p, serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		`"@method": GET`,
+		`"@authority": example.com`,
+		`"@path": /a%20b`,
+		`"@query": ?x=1&y=2`,
+		`"x-custom": first, second`,
+		`"@signature-params": ` + serialized,
+	}, "\n")
+	if base != want {
+		t.Fatalf("signature base =\n%s\nwant\n%s", base, want)
+	}
+	if got := req.Header.Values("X-Custom"); got[0] != "  first " {
+		t.Errorf("signature base rewrote the request header: %q", got)
+	}
+
+	if _, err := signatureBase(req, &params{components: []string{"x-missing"}}, ""); err == nil {
+		t.Error("signature base without a covered header succeeded")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	verifier := NewVerifier(VerifierConfig{Keys: map[string][]byte{"billing": testKey}, Nonces: newMemoryStore()})
+	req := signed(t, &Signer{KeyID: "billing", Key: testKey}, `{"amount":10}`)
+
+	keyID, err := verifier.Verify(req)
+	if err != nil || keyID != "billing" {
+		t.Fatalf("Verify = %q, %v", keyID, err)
+	}
+	body, _ := io.ReadAll(req.Body)
+	if string(body) != `{"amount":10}` {
+		t.Errorf("body after Verify = %q", body)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	signer := &Signer{KeyID: "billing", Key: testKey}
+	for _, tc := range []struct {
+		name string
+		req  func(t *testing.T) *http.Request
+		err  error
+	}{
+		{name: "unsigned", req: func(t *testing.T) *http.Request { return newRequest(t, "") }, err: ErrMissingSignature},
+		{name: "wrong key", req: func(t *testing.T) *http.Request {
+			return signed(t, &Signer{KeyID: "billing", Key: []byte("another key")}, "")
+		}, err: ErrInvalidSignature},
+		{name: "unknown key id", req: func(t *testing.T) *http.Request {
+			return signed(t, &Signer{KeyID: "shipping", Key: testKey}, "")
+		}, err: ErrUnknownKey},
+		{name: "created too old", req: func(t *testing.T) *http.Request {
+			req := newRequest(t, "")
+			signAt(t, req, "billing", time.Now().Add(-10*time.Minute))
+			return req
+		}, err: ErrExpired},
+		{name: "created in the future", req: func(t *testing.T) *http.Request {
+			req := newRequest(t, "")
+			signAt(t, req, "billing", time.Now().Add(10*time.Minute))
+			return req
+		}, err: ErrExpired},
+		{name: "tampered body", req: func(t *testing.T) *http.Request {
+			req := signed(t, signer, `{"amount":10}`)
+			req.Body = io.NopCloser(strings.NewReader(`{"amount":1000}`))
+			return req
+		}, err: ErrDigestMismatch},
+		{name: "wrong content digest", req: func(t *testing.T) *http.Request {
+			req := signed(t, signer, `{"amount":10}`)
+			req.Header.Set("Content-Digest", contentDigest([]byte("other")))
+			return req
+		}, err: ErrDigestMismatch},
+		{name: "tampered query", req: func(t *testing.T) *http.Request {
+			req := signed(t, signer, "")
+			req.URL.RawQuery = "amount=1000"
+			return req
+		}, err: ErrInvalidSignature},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			verifier := NewVerifier(VerifierConfig{Keys: map[string][]byte{"billing": testKey}})
+			if _, err := verifier.Verify(tc.req(t)); !errors.Is(err, tc.err) {
+				t.Fatalf("Verify = %v, want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestVerifyRequiresComponents(t *testing.T) {
+	verifier := NewVerifier(VerifierConfig{Keys: map[string][]byte{"billing": testKey}})
+	req := signed(t, &Signer{KeyID: "billing", Key: testKey, Components: []string{"@method", "@path"}}, "")
+	if _, err := verifier.Verify(req); err == nil || !strings.Contains(err.Error(), "@authority is not covered") {
+		t.Fatalf("Verify without required components = %v", err)
+	}
+}
+
+func TestVerifyRejectsReplay(t *testing.T) {
+	verifier := NewVerifier(VerifierConfig{Keys: map[string][]byte{"billing": testKey}, Nonces: newMemoryStore()})
+	req := signed(t, &Signer{KeyID: "billing", Key: testKey}, "")
+	if _, err := verifier.Verify(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifier.Verify(req); !errors.Is(err, ErrReplayed) {
+		t.Fatalf("second Verify = %v, want ErrReplayed", err)
+	}
+}
+
+func TestRequireFailsClosedOnNonceStoreErrors(t *testing.T) {
+	store := newMemoryStore()
+	store.err = errors.New("connection refused")
+	verifier := NewVerifier(VerifierConfig{Keys: map[string][]byte{"billing": testKey}, Nonces: store})
+	req := signed(t, &Signer{KeyID: "billing", Key: testKey}, "")
+
+	l := &context.LuxContext{Request: req, Response: context.NewResponse()}
+	if _, status := Require(verifier).Request(l); status != http.StatusInternalServerError {
+		t.Fatalf("Require with a failing nonce store = %d, want 500", status)
+	}
+	if _, err := verifier.Verify(req); !errors.Is(err, ErrNonceStore) || !errors.Is(err, store.err) {
+		t.Fatalf("Verify with a failing nonce store = %v", err)
+	}
+
+	store.err = nil
+	l = &context.LuxContext{Request: req, Response: context.NewResponse()}
+	if _, status := Require(verifier).Request(l); status != http.StatusOK || l.Principal != "billing" {
+		t.Fatalf("Require = %d with principal %q", status, l.Principal)
+	}
+	if _, status := Require(verifier).Request(l); status != http.StatusUnauthorized {
+		t.Fatalf("Require on a replay = %d, want 401", status)
+	}
+}
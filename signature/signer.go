@@ -0,0 +1,93 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type Signer struct {
+	KeyID string
+	Key   []byte
+	// Components are the covered components: @method, @authority, @path, @query and lower case header names.
+	// Empty means DefaultComponents.
+	Components []string
+	Label      string
+}
+
+// Sign sets Content-Digest, Signature-Input and Signature on req. The body is read and restored.
+func (s *Signer) Sign(req *http.Request) error {
+	body := []byte(nil)
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(body)), nil
+		}
+	}
+	req.Header.Set("Content-Digest", contentDigest(body))
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	components := s.Components
+	if len(components) == 0 {
+		components = DefaultComponents
+	}
+	p := &params{
+		components: make([]string, len(components)),
+		created:    time.Now().Unix(),
+		keyID:      s.KeyID,
+		nonce:      base64.RawURLEncoding.EncodeToString(nonce),
+		alg:        Algorithm,
+	}
+	for i, c := range components {
+		p.components[i] = strings.ToLower(c)
+	}
+	serialized := p.serialize()
+	base, err := signatureBase(req, p, serialized)
+	if err != nil {
+		return err
+	}
+
+	label := s.Label
+	if label == "" {
+		label = DefaultLabel
+	}
+	req.Header.Set("Signature-Input", label+"="+serialized)
+	req.Header.Set("Signature", label+"=:"+base64.StdEncoding.EncodeToString(sign(s.Key, base))+":")
+	return nil
+}
+
+// Transport signs every request before handing it to base, or http.DefaultTransport when base is nil.
+func (s *Signer) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		if err := s.Sign(req); err != nil {
+			return nil, err
+		}
+		return base.RoundTrip(req)
+	})
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,297 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/snowmerak/lux/context"
+	"github.com/snowmerak/lux/middleware"
+	"github.com/snowmerak/lux/store/keyvalue"
+)
+
+const (
+	DefaultMaxSkew     = 5 * time.Minute
+	DefaultMaxBodySize = 10 << 20
+	DefaultNoncePrefix = "lux:signature:nonce:"
+)
+
+type VerifierConfig struct {
+	// Keys maps key ids to shared secrets. Lookup replaces it when set.
+	Keys   map[string][]byte
+	Lookup func(keyID string) ([]byte, bool)
+	// Nonces remembers used nonces until their signature expires. Without it replays are only bounded by MaxSkew.
+	// Get must return keyvalue.ErrNotFound, or a nil value, for unused nonces. Other errors fail the request.
+	Nonces      keyvalue.KeyValue
+	NoncePrefix string
+	// MaxSkew is how far created may be from now. Zero means DefaultMaxSkew.
+	MaxSkew time.Duration
+	// Required components must all be covered by the signature. Nil means DefaultComponents.
+	Required []string
+	Label    string
+	// MaxBodySize bounds the body read to check its digest. Zero means DefaultMaxBodySize.
+	MaxBodySize int64
+}
+
+type Verifier struct {
+	cfg  VerifierConfig
+	lock sync.Mutex
+}
+
+func NewVerifier(cfg VerifierConfig) *Verifier {
+	if cfg.Lookup == nil {
+		keys := cfg.Keys
+		cfg.Lookup = func(keyID string) ([]byte, bool) {
+			key, ok := keys[keyID]
+			return key, ok
+		}
+	}
+	if cfg.NoncePrefix == "" {
+		cfg.NoncePrefix = DefaultNoncePrefix
+	}
+	if cfg.MaxSkew <= 0 {
+		cfg.MaxSkew = DefaultMaxSkew
+	}
+	if cfg.Required == nil {
+		cfg.Required = DefaultComponents
+	}
+	if cfg.Label == "" {
+		cfg.Label = DefaultLabel
+	}
+	if cfg.MaxBodySize <= 0 {
+		cfg.MaxBodySize = DefaultMaxBodySize
+	}
+	return &Verifier{cfg: cfg}
+}
+
+// Require verifies signed requests and sets LuxContext.Principal to the key id. Failures get 401,
+// and nonce store errors 500.
+func Require(v *Verifier) middleware.Set {
+	return middleware.Set{
+		Request: func(l *context.LuxContext) (*context.LuxContext, int) {
+			keyID, err := v.Verify(l.Request)
+			if errors.Is(err, ErrNonceStore) {
+				if l.Logger != nil {
+					l.Logger.Error().Str("key_id", keyID).Str("path", l.Request.URL.Path).Err(err).Msg("Request signature nonce check failed")
+				}
+				return l, http.StatusInternalServerError
+			}
+			if err != nil {
+				if l.Logger != nil {
+					l.Logger.Info().Str("key_id", keyID).Str("path", l.Request.URL.Path).Str("remote", l.GetRemoteIP()).Err(err).Msg("Request signature rejected")
+				}
+				return l, http.StatusUnauthorized
+			}
+			l.Principal = keyID
+			return l, http.StatusOK
+		},
+		Response: nil,
+	}
+}
+
+// Verify checks the signature of r and returns its key id. The body is read to check its digest and restored.
+func (v *Verifier) Verify(r *http.Request) (string, error) {
+	serialized, ok := dictionaryMember(r.Header.Get("Signature-Input"), v.cfg.Label)
+	if !ok {
+		return "", ErrMissingSignature
+	}
+	rawSignature, ok := dictionaryMember(r.Header.Get("Signature"), v.cfg.Label)
+	if !ok || len(rawSignature) < 2 || rawSignature[0] != ':' || rawSignature[len(rawSignature)-1] != ':' {
+		return "", ErrMissingSignature
+	}
+	signature, err := base64.StdEncoding.DecodeString(rawSignature[1 : len(rawSignature)-1])
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	p, err := parseParams(serialized)
+	if err != nil {
+		return "", err
+	}
+	if p.alg != "" && p.alg != Algorithm {
+		return p.keyID, fmt.Errorf("signature: unsupported algorithm %q", p.alg)
+	}
+	for _, required := range v.cfg.Required {
+		if !contains(p.components, required) {
+			return p.keyID, fmt.Errorf("signature: %s is not covered", required)
+		}
+	}
+	if p.nonce == "" {
+		return p.keyID, fmt.Errorf("signature: missing nonce")
+	}
+	created := time.Unix(p.created, 0)
+	if skew := time.Since(created); skew > v.cfg.MaxSkew || skew < -v.cfg.MaxSkew {
+		return p.keyID, ErrExpired
+	}
+	key, ok := v.cfg.Lookup(p.keyID)
+	if !ok {
+		return p.keyID, ErrUnknownKey
+	}
+
+	if contains(p.components, "content-digest") {
+		if err := v.checkDigest(r); err != nil {
+			return p.keyID, err
+		}
+	}
+	base, err := signatureBase(r, p, serialized)
+	if err != nil {
+		return p.keyID, err
+	}
+	if !hmac.Equal(signature, sign(key, base)) {
+		return p.keyID, ErrInvalidSignature
+	}
+	if err := v.useNonce(p.keyID, p.nonce, created.Add(v.cfg.MaxSkew)); err != nil {
+		return p.keyID, err
+	}
+	return p.keyID, nil
+}
+
+func (v *Verifier) checkDigest(r *http.Request) error {
+	body := []byte(nil)
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, v.cfg.MaxBodySize+1))
+		r.Body.Close()
+		if err != nil {
+			return err
+		}
+		if int64(len(body)) > v.cfg.MaxBodySize {
+			return &http.MaxBytesError{Limit: v.cfg.MaxBodySize}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if !hmac.Equal([]byte(r.Header.Get("Content-Digest")), []byte(contentDigest(body))) {
+		return ErrDigestMismatch
+	}
+	return nil
+}
+
+// useNonce records the nonce with the time its signature expires. An entry past that time can be
+// overwritten, because its signature would be rejected for skew anyway.
+func (v *Verifier) useNonce(keyID, nonce string, expiresAt time.Time) error {
+	if v.cfg.Nonces == nil {
+		return nil
+	}
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	key := v.cfg.NoncePrefix + keyID + ":" + nonce
+	value, err := v.cfg.Nonces.Get(key)
+	if err != nil && !errors.Is(err, keyvalue.ErrNotFound) {
+		return fmt.Errorf("%w: %w", ErrNonceStore, err)
+	}
+	if err == nil && value != nil {
+		if until, ok := unixValue(value); ok && time.Now().Unix() <= until {
+			return ErrReplayed
+		}
+	}
+	if err := v.cfg.Nonces.Set(key, strconv.FormatInt(expiresAt.Unix(), 10)); err != nil {
+		return fmt.Errorf("%w: %w", ErrNonceStore, err)
+	}
+	return nil
+}
+
+func unixValue(value any) (int64, bool) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+// dictionaryMember returns the raw value of a structured field dictionary member.
+func dictionaryMember(header, name string) (string, bool) {
+	for _, member := range splitTopLevel(header, ',') {
+		key, value, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if ok && key == name {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func parseParams(serialized string) (*params, error) {
+	end := strings.IndexByte(serialized, ')')
+	if !strings.HasPrefix(serialized, "(") || end < 0 {
+		return nil, ErrInvalidSignature
+	}
+	p := &params{}
+	for _, item := range strings.Fields(serialized[1:end]) {
+		component, err := strconv.Unquote(item)
+		if err != nil {
+			return nil, ErrInvalidSignature
+		}
+		p.components = append(p.components, component)
+	}
+	for _, param := range splitTopLevel(serialized[end+1:], ';') {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		switch key {
+		case "created":
+			created, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, ErrInvalidSignature
+			}
+			p.created = created
+		case "keyid":
+			p.keyID = value
+		case "nonce":
+			p.nonce = value
+		case "alg":
+			p.alg = value
+		}
+	}
+	if p.created == 0 || p.keyID == "" {
+		return nil, ErrInvalidSignature
+	}
+	return p, nil
+}
+
+func splitTopLevel(s string, sep byte) []string {
+	parts := []string(nil)
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
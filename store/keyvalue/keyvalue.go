@@ -1,5 +1,11 @@
 package keyvalue
 
+import "errors"
+
+// ErrNotFound is returned, possibly wrapped, by Get for a missing key.
+// A nil value with a nil error also means the key is missing.
+var ErrNotFound = errors.New("keyvalue: not found")
+
 type KeyValue interface {
 	Set(key string, value interface{}) error
 	Get(key string) (interface{}, error)
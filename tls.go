@@ -0,0 +1,69 @@
+package lux
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+
+	"github.com/snowmerak/lux/certs"
+)
+
+type ClientAuth int
+
+const (
+	ClientAuthNone ClientAuth = iota
+	// ClientAuthOptional verifies a client certificate when one is sent.
+	ClientAuthOptional
+	// ClientAuthRequired rejects the handshake without a valid client certificate.
+	ClientAuthRequired
+)
+
+// SetTLSConfig sets the tls.Config used by the TLS listen methods. Certificates in it make
+// the certFile and keyFile arguments optional.
+func (l *Lux) SetTLSConfig(cfg *tls.Config) {
+	l.server.TLSConfig = cfg
+}
+
+func (l *Lux) TLSConfig() *tls.Config {
+	if l.server.TLSConfig == nil {
+		l.server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return l.server.TLSConfig
+}
+
+// SetClientAuth verifies client certificates against pool. Verified identities are exposed as LuxContext.ClientCert.
+func (l *Lux) SetClientAuth(pool *x509.CertPool, mode ClientAuth) {
+	cfg := l.TLSConfig()
+	cfg.ClientCAs = pool
+	switch mode {
+	case ClientAuthRequired:
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	case ClientAuthOptional:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		cfg.ClientAuth = tls.NoClientCert
+	}
+}
+
+// LoadCertPool reads PEM encoded certificates from files.
+func LoadCertPool(files ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.New("no certificates found in " + file)
+		}
+	}
+	return pool, nil
+}
+
+// SetCertificateManager serves the certificates of m by SNI, keeping the rest of the TLS config,
+// and exports their expiry as metrics. The certFile and keyFile arguments of the TLS listen methods may then be empty.
+func (l *Lux) SetCertificateManager(m *certs.Manager) {
+	l.TLSConfig().GetCertificate = m.GetCertificate
+	m.RegisterMetrics(l.metrics.Registry())
+}
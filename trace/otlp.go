@@ -0,0 +1,280 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DefaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+
+type OTLPConfig struct {
+	Endpoint      string
+	Headers       map[string]string
+	Client        *http.Client
+	BatchSize     int
+	QueueSize     int
+	FlushInterval time.Duration
+	OnError       func(error)
+}
+
+// OTLPExporter sends spans to a collector with OTLP/HTTP using the JSON encoding.
+type OTLPExporter struct {
+	endpoint      string
+	headers       map[string]string
+	client        *http.Client
+	batchSize     int
+	flushInterval time.Duration
+	onError       func(error)
+
+	queue  chan SpanData
+	done   chan struct{}
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewOTLPExporter(cfg OTLPConfig) *OTLPExporter {
+	e := &OTLPExporter{
+		endpoint:      cfg.Endpoint,
+		headers:       cfg.Headers,
+		client:        cfg.Client,
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		onError:       cfg.OnError,
+		done:          make(chan struct{}),
+	}
+	if e.endpoint == "" {
+		e.endpoint = DefaultOTLPEndpoint
+	}
+	if e.client == nil {
+		e.client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if e.batchSize <= 0 {
+		e.batchSize = 512
+	}
+	if e.flushInterval <= 0 {
+		e.flushInterval = 5 * time.Second
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = 2048
+	}
+	e.queue = make(chan SpanData, queueSize)
+	go e.run()
+	return e
+}
+
+// Export queues spans for the next batch. Spans are dropped when the queue is full
+// or the exporter is shut down.
+func (e *OTLPExporter) Export(_ context.Context, spans []SpanData) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return nil
+	}
+	for _, span := range spans {
+		select {
+		case e.queue <- span:
+		default:
+		}
+	}
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.mu.Unlock()
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *OTLPExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.flushInterval)
+	defer ticker.Stop()
+	batch := make([]SpanData, 0, e.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.send(batch); err != nil && e.onError != nil {
+			e.onError(err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case span, ok := <-e.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= e.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (e *OTLPExporter) send(spans []SpanData) error {
+	body, err := json.Marshal(encodeOTLP(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("otlp export: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	TraceState        string         `json:"traceState,omitempty"`
+	Name              string         `json:"name"`
+	Kind              Kind           `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    StatusCode `json:"code,omitempty"`
+	Message string     `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func encodeOTLP(spans []SpanData) otlpRequest {
+	byService := map[string][]otlpSpan{}
+	for _, span := range spans {
+		byService[span.Service] = append(byService[span.Service], otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			TraceState:        span.TraceState,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        encodeAttributes(span.Attributes),
+			Status: otlpStatus{
+				Code:    span.StatusCode,
+				Message: span.StatusMessage,
+			},
+		})
+	}
+
+	req := otlpRequest{}
+	for service, otlpSpans := range byService {
+		req.ResourceSpans = append(req.ResourceSpans, otlpResourceSpans{
+			Resource: otlpResource{
+				Attributes: encodeAttributes(map[string]any{"service.name": service}),
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/snowmerak/lux"},
+				Spans: otlpSpans,
+			}},
+		})
+	}
+	return req
+}
+
+func encodeAttributes(attributes map[string]any) []otlpKeyValue {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	kvs := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		kvs = append(kvs, otlpKeyValue{Key: key, Value: encodeValue(attributes[key])})
+	}
+	return kvs
+}
+
+func encodeValue(v any) otlpAnyValue {
+	switch v := v.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int:
+		s := strconv.FormatInt(int64(v), 10)
+		return otlpAnyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpAnyValue{IntValue: &s}
+	case float64:
+		return otlpAnyValue{DoubleValue: &v}
+	default:
+		s := fmt.Sprint(v)
+		return otlpAnyValue{StringValue: &s}
+	}
+}
@@ -0,0 +1,148 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOTLPExporterSendsSpansOnShutdown(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		requests []otlpRequest
+		headers  []http.Header
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lock.Lock()
+		requests = append(requests, req)
+		headers = append(headers, r.Header.Clone())
+		lock.Unlock()
+	}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(OTLPConfig{
+		Endpoint:      collector.URL,
+		Headers:       map[string]string{"Authorization": "Bearer token"},
+		FlushInterval: time.Hour,
+	})
+	tracer := NewTracer("api", exporter)
+	ctx, parent := tracer.Start(context.Background(), "GET /users", KindServer)
+	_, child := StartChild(ctx, "db")
+	child.SetAttribute("db.rows", 3)
+	child.End()
+	parent.SetStatus(StatusError, "boom")
+	parent.End()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(requests) != 1 {
+		t.Fatalf("got %d export requests, want 1", len(requests))
+	}
+	if got := headers[0].Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization = %q", got)
+	}
+	if got := headers[0].Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	resource := requests[0].ResourceSpans
+	if len(resource) != 1 || len(resource[0].ScopeSpans) != 1 {
+		t.Fatalf("unexpected payload shape: %+v", requests[0])
+	}
+	if attrs := resource[0].Resource.Attributes; len(attrs) != 1 || attrs[0].Key != "service.name" || *attrs[0].Value.StringValue != "api" {
+		t.Errorf("resource attributes = %+v", attrs)
+	}
+	spans := resource[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	db, root := spans[0], spans[1]
+	if db.Name != "db" || root.Name != "GET /users" {
+		t.Fatalf("span names = %q, %q", db.Name, root.Name)
+	}
+	if db.TraceID != root.TraceID || db.ParentSpanID != root.SpanID {
+		t.Errorf("child is not linked to its parent: %+v %+v", db, root)
+	}
+	if len(db.Attributes) != 1 || *db.Attributes[0].Value.IntValue != "3" {
+		t.Errorf("child attributes = %+v", db.Attributes)
+	}
+	if root.Status.Code != StatusError || root.Status.Message != "boom" {
+		t.Errorf("root status = %+v", root.Status)
+	}
+}
+
+func TestOTLPExporterExportAfterShutdown(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(OTLPConfig{Endpoint: collector.URL})
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if err := exporter.Export(context.Background(), []SpanData{{Name: "late"}}); err != nil {
+		t.Fatalf("export after shutdown: %v", err)
+	}
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatalf("second shutdown: %v", err)
+	}
+}
+
+func TestOTLPExporterConcurrentExportAndShutdown(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(OTLPConfig{Endpoint: collector.URL})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				exporter.Export(context.Background(), []SpanData{{Name: "span"}})
+			}
+		}()
+	}
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	wg.Wait()
+}
+
+func TestOTLPExporterReportsCollectorErrors(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+
+	errs := make(chan error, 1)
+	exporter := NewOTLPExporter(OTLPConfig{
+		Endpoint: collector.URL,
+		OnError:  func(err error) { errs <- err },
+	})
+	exporter.Export(context.Background(), []SpanData{{Name: "span"}})
+	if err := exporter.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatal("OnError called with nil")
+		}
+	default:
+		t.Fatal("OnError was not called for a 503")
+	}
+}
@@ -0,0 +1,120 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+type TraceID [16]byte
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+type SpanID [8]byte
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+const flagSampled = 0x01
+
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+	Remote     bool
+}
+
+func (s SpanContext) IsValid() bool {
+	return s.TraceID.IsValid() && s.SpanID.IsValid()
+}
+
+func (s SpanContext) IsSampled() bool {
+	return s.Flags&flagSampled != 0
+}
+
+func (s SpanContext) Traceparent() string {
+	return "00-" + s.TraceID.String() + "-" + s.SpanID.String() + "-" + hex.EncodeToString([]byte{s.Flags})
+}
+
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+func ParseTraceparent(value string) (SpanContext, error) {
+	sc := SpanContext{}
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, ErrInvalidTraceparent
+	}
+	version, err := hex.DecodeString(parts[0])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(parts) != 4) {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, ErrInvalidTraceparent
+	}
+	sc.Remote = true
+	return sc, nil
+}
+
+func Extract(header http.Header) (SpanContext, bool) {
+	sc, err := ParseTraceparent(header.Get(TraceparentHeader))
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.TraceState = strings.Join(header.Values(TracestateHeader), ",")
+	return sc, true
+}
+
+func Inject(ctx context.Context, header http.Header) {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return
+	}
+	sc := span.SpanContext()
+	header.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		header.Set(TracestateHeader, sc.TraceState)
+	}
+}
+
+func newTraceID() TraceID {
+	t := TraceID{}
+	rand.Read(t[:])
+	return t
+}
+
+func newSpanID() SpanID {
+	s := SpanID{}
+	rand.Read(s[:])
+	return s
+}
@@ -0,0 +1,245 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOK    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+	Shutdown(ctx context.Context) error
+}
+
+type SpanData struct {
+	Name          string         `json:"name"`
+	Kind          Kind           `json:"kind"`
+	TraceID       string         `json:"traceId"`
+	SpanID        string         `json:"spanId"`
+	ParentSpanID  string         `json:"parentSpanId,omitempty"`
+	TraceState    string         `json:"traceState,omitempty"`
+	Start         time.Time      `json:"start"`
+	End           time.Time      `json:"end"`
+	Attributes    map[string]any `json:"attributes,omitempty"`
+	StatusCode    StatusCode     `json:"statusCode"`
+	StatusMessage string         `json:"statusMessage,omitempty"`
+	Service       string         `json:"service"`
+}
+
+type Tracer struct {
+	service     string
+	exporters   []Exporter
+	sampleRatio float64
+}
+
+func NewTracer(service string, exporters ...Exporter) *Tracer {
+	return &Tracer{
+		service:     service,
+		exporters:   exporters,
+		sampleRatio: 1,
+	}
+}
+
+// SetSampleRatio sets the fraction of new traces that are recorded.
+// Traces continued from a remote parent follow the parent's sampled flag.
+func (t *Tracer) SetSampleRatio(ratio float64) {
+	t.sampleRatio = ratio
+}
+
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	var parent SpanContext
+	if span := SpanFromContext(ctx); span != nil {
+		parent = span.SpanContext()
+	} else if sc, ok := remoteFromContext(ctx); ok {
+		parent = sc
+	}
+
+	sc := SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+	} else {
+		sc.TraceID = newTraceID()
+		if t.sampleRatio >= 1 || rand.Float64() < t.sampleRatio {
+			sc.Flags = flagSampled
+		}
+	}
+
+	span := &Span{
+		tracer: t,
+		sc:     sc,
+		parent: parent.SpanID,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	errs := []error(nil)
+	for _, exporter := range t.exporters {
+		if err := exporter.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (t *Tracer) export(data SpanData) {
+	for _, exporter := range t.exporters {
+		exporter.Export(context.Background(), []SpanData{data})
+	}
+}
+
+// StartChild starts an internal span under the span in ctx.
+// It returns a nil span when ctx carries no span, and every Span method accepts a nil receiver.
+func StartChild(ctx context.Context, name string) (context.Context, *Span) {
+	parent := SpanFromContext(ctx)
+	if parent == nil {
+		return ctx, nil
+	}
+	return parent.tracer.Start(ctx, name, KindInternal)
+}
+
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent SpanID
+	kind   Kind
+	start  time.Time
+
+	lock          sync.Mutex
+	name          string
+	attributes    map[string]any
+	statusCode    StatusCode
+	statusMessage string
+	ended         bool
+}
+
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+func (s *Span) Tracer() *Tracer {
+	if s == nil {
+		return nil
+	}
+	return s.tracer
+}
+
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.name = name
+}
+
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.attributes == nil {
+		s.attributes = map[string]any{}
+	}
+	s.attributes[key] = value
+}
+
+func (s *Span) SetStatus(code StatusCode, message string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.statusCode = code
+	s.statusMessage = message
+}
+
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.SetStatus(StatusError, err.Error())
+}
+
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		Name:          s.name,
+		Kind:          s.kind,
+		TraceID:       s.sc.TraceID.String(),
+		SpanID:        s.sc.SpanID.String(),
+		TraceState:    s.sc.TraceState,
+		Start:         s.start,
+		End:           time.Now(),
+		Attributes:    s.attributes,
+		StatusCode:    s.statusCode,
+		StatusMessage: s.statusMessage,
+		Service:       s.tracer.service,
+	}
+	if s.parent.IsValid() {
+		data.ParentSpanID = s.parent.String()
+	}
+	s.lock.Unlock()
+
+	if s.sc.IsSampled() {
+		s.tracer.export(data)
+	}
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemote stores a span context received from a peer, so the next Start continues its trace.
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+func remoteFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(remoteKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
@@ -0,0 +1,127 @@
+package util
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+type TrustedProxies struct {
+	nets []*net.IPNet
+}
+
+// NewTrustedProxies accepts CIDRs like "10.0.0.0/8" and single addresses like "127.0.0.1" or "::1".
+func NewTrustedProxies(cidrs ...string) (*TrustedProxies, error) {
+	t := &TrustedProxies{}
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: cidr}
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			t.nets = append(t.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		t.nets = append(t.nets, ipNet)
+	}
+	return t, nil
+}
+
+func (t *TrustedProxies) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range t.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP resolves the address of the client that sent r.
+// Forwarding headers are only read when the peer is a trusted proxy, and the hop chain is walked
+// from the nearest hop until an untrusted address is found.
+// Forwarded (RFC 7239) takes precedence over X-Forwarded-For, which takes precedence over X-Real-IP.
+func (t *TrustedProxies) ClientIP(r *http.Request) string {
+	remote := GetIP(r.RemoteAddr)
+	if !t.Contains(net.ParseIP(remote)) {
+		return remote
+	}
+
+	hops := parseForwarded(r.Header.Values("Forwarded"))
+	if len(hops) == 0 {
+		hops = parseXForwardedFor(r.Header.Values("X-Forwarded-For"))
+	}
+	if len(hops) == 0 {
+		if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+			return ip.String()
+		}
+		return remote
+	}
+
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			break
+		}
+		client = ip.String()
+		if !t.Contains(ip) {
+			break
+		}
+	}
+	return client
+}
+
+func parseXForwardedFor(values []string) []string {
+	hops := []string(nil)
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			hop = strings.TrimSpace(hop)
+			if hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+func parseForwarded(values []string) []string {
+	hops := []string(nil)
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(key, "for") {
+					continue
+				}
+				hops = append(hops, forwardedNode(val))
+			}
+		}
+	}
+	return hops
+}
+
+func forwardedNode(node string) string {
+	node = strings.Trim(strings.TrimSpace(node), `"`)
+	if strings.HasPrefix(node, "[") {
+		if end := strings.Index(node, "]"); end > 0 {
+			return node[1:end]
+		}
+		return node
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+	return node
+}